@@ -12,16 +12,19 @@ import (
 var (
 	logLevelVerbose = false
 	discardAttr     = slog.Attr{} // zero `Attr` means discard
+
+	// level of the logger set up by `Execute()`. can be changed at runtime (f.ex. with `httputils.DebugHandler()`)
+	LogLevel = &slog.LevelVar{}
 )
 
 func configureLogging() {
-	logLevel := func() slog.Level {
+	LogLevel.Set(func() slog.Level {
 		if logLevelVerbose {
 			return slog.LevelDebug
 		} else {
 			return slog.LevelInfo
 		}
-	}()
+	}())
 
 	addSource := func() bool {
 		if logLevelVerbose {
@@ -37,7 +40,7 @@ func configureLogging() {
 	logHandler := func() slog.Handler {
 		if errorStreamIsUserTerminal { // output format optimized to looking at from terminal
 			return tint.NewHandler(errorStream, &tint.Options{
-				Level:      logLevel,
+				Level:      LogLevel,
 				AddSource:  addSource,
 				TimeFormat: time.TimeOnly, // not using freedom time (`time.Kitchen`)
 				// intentionally not giving `ReplaceAttr` because for terminal we can always include times
@@ -49,7 +52,7 @@ func configureLogging() {
 			}
 
 			return slog.NewTextHandler(errorStream, &slog.HandlerOptions{
-				Level:       logLevel,
+				Level:       LogLevel,
 				AddSource:   addSource,
 				ReplaceAttr: logAttrReplacer,
 			})
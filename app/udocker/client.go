@@ -3,12 +3,11 @@
 package udocker
 
 import (
-	"context"
 	"crypto/tls"
-	"net"
 	"net/http"
 	"net/url"
 
+	"github.com/function61/gokit/net/http/ezhttp"
 	"github.com/function61/gokit/os/osutil"
 )
 
@@ -29,14 +28,7 @@ func Client(
 	}
 
 	if u.Scheme == "unix" { // unix socket needs own dialer
-		return &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
-					dialer := net.Dialer{} // don't know why we need a struct to use DialContext()
-					return dialer.DialContext(ctx, "unix", u.Path)
-				},
-			},
-		}, "http://localhost", nil
+		return ezhttp.UnixSocketClient(u.Path), "http://localhost", nil
 	}
 
 	clientCertificate, err := clientCertificateLoader()
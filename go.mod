@@ -1,6 +1,6 @@
 module github.com/function61/gokit
 
-go 1.20
+go 1.21
 
 require (
 	github.com/apex/gateway v1.1.1
@@ -8,12 +8,14 @@ require (
 	github.com/aws/aws-sdk-go v1.16.15
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/hashicorp/hcl v1.0.0
+	github.com/lmittmann/tint v1.0.5
 	github.com/mattn/go-isatty v0.0.20
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/xattr v0.4.4
 	github.com/prometheus/client_golang v1.1.0
 	github.com/prometheus/common v0.9.1
 	github.com/spf13/cobra v1.6.1
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	golang.org/x/sys v0.6.0
@@ -24,12 +26,10 @@ require (
 	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
 	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
-	github.com/lmittmann/tint v1.0.5 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/procfs v0.0.8 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/testify v1.6.1 // indirect
 	github.com/tj/assert v0.0.3 // indirect
 )
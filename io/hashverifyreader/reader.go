@@ -34,6 +34,8 @@ import (
              v
 */
 
+var ErrDigestMismatch = errors.New("hashVerifyReader: digest mismatch")
+
 // creates a two-part reader whose first part is connected to source, and the second part
 // (= when source read to EOF) Read() (on hashVerifyReader) immediately returns EOF if hash matches
 func New(source io.Reader, hash hash.Hash, expectedHash []byte) io.Reader {
@@ -57,7 +59,7 @@ type hashVerifyReader struct {
 
 func (h *hashVerifyReader) Read([]byte) (int, error) {
 	if !bytes.Equal(h.hash.Sum(nil), h.expectedHash) {
-		return 0, errors.New("hashVerifyReader: digest mismatch")
+		return 0, ErrDigestMismatch
 	}
 
 	return 0, io.EOF
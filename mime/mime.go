@@ -82,6 +82,22 @@ func ExtensionByType(contentType string, fallback string) string {
 	return spec.Extensions[0]
 }
 
+// "text/html" => Spec{Extensions: ["html", ...], Compressible: true, ...}
+func SpecByType(contentType string) (Spec, bool) {
+	spec, found := mimeTypes[contentType]
+	if !found {
+		return Spec{}, false
+	}
+
+	return *spec, true // copy so callers can't modify the DB
+}
+
+// whether it makes sense to gzip etc. this content type. false if unknown
+func Compressible(contentType string) bool {
+	spec, found := mimeTypes[contentType]
+	return found && spec.Compressible != nil && *spec.Compressible
+}
+
 // Is("image/jpeg", TypeImage) => true
 // Is("text/plain", TypeImage) => false
 func Is(contentType string, typ Type) bool {
@@ -35,3 +35,16 @@ func TestIs(t *testing.T) {
 	assert.Equal(t, Is("image", TypeImage), false)
 	assert.Equal(t, Is("text/plain", TypeImage), false)
 }
+
+func TestSpecByType(t *testing.T) {
+	spec, found := SpecByType("text/html")
+	assert.Equal(t, found, true)
+	assert.Equal(t, spec.Extensions[0], "html")
+
+	_, found = SpecByType("dunno/notfound")
+	assert.Equal(t, found, false)
+
+	assert.Equal(t, Compressible("text/html"), true)
+	assert.Equal(t, Compressible("image/jpeg"), false)
+	assert.Equal(t, Compressible("dunno/notfound"), false)
+}
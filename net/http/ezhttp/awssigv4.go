@@ -0,0 +1,256 @@
+package ezhttp
+
+// AWS Signature Version 4 request signing, for S3-compatible stores and other AWS APIs
+// without having to pull in the whole AWS SDK.
+//
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_aws-signing.html
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	awsV4Algorithm       = "AWS4-HMAC-SHA256"
+	awsV4TimeFormat      = "20060102T150405Z"
+	awsV4DateFormat      = "20060102"
+	awsV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // only for temporary credentials
+}
+
+type AWSv4Signer struct {
+	credentials AWSCredentials
+	region      string
+	service     string // "s3", "execute-api" etc.
+	now         func() time.Time
+}
+
+func NewAWSv4Signer(credentials AWSCredentials, region string, service string) *AWSv4Signer {
+	return &AWSv4Signer{
+		credentials: credentials,
+		region:      region,
+		service:     service,
+		now:         time.Now,
+	}
+}
+
+// signs the request just before it is sent, so all headers given by other ConfigPieces are final.
+// request body is hashed (and thus buffered in memory if it can't be re-read).
+func SignAWSv4(signer *AWSv4Signer) ConfigPiece {
+	return After(func(conf *Config) {
+		conf.TransportMiddlewares = append(conf.TransportMiddlewares, func(inner http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				signed := req.Clone(req.Context()) // RoundTripper must not modify the given request
+				if err := signer.Sign(signed); err != nil {
+					return nil, err
+				}
+
+				return inner.RoundTrip(signed)
+			})
+		})
+	})
+}
+
+// adds the authentication headers to *req*
+func (s *AWSv4Signer) Sign(req *http.Request) error {
+	body, err := peekRequestBody(req)
+	if err != nil {
+		return fmt.Errorf("AWSv4Signer: %w", err)
+	}
+
+	now := s.now().UTC()
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", now.Format(awsV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash) // required by S3, harmless for others
+	if s.credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.credentials.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := awsV4CanonicalHeaders(req)
+
+	signature := s.signature(now, awsV4CanonicalRequest(req.Method, req.URL, s.service, canonicalHeaders, signedHeaders, payloadHash))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsV4Algorithm,
+		s.credentials.AccessKeyID,
+		s.scope(now),
+		signedHeaders,
+		signature))
+
+	return nil
+}
+
+// returns an URL that anyone can use (until it expires) to make the request without credentials.
+// payload is not signed. for S3 *expires* can be at most 7 days.
+func (s *AWSv4Signer) Presign(method string, rawURL string, expires time.Duration) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("AWSv4Signer.Presign: %w", err)
+	}
+
+	now := s.now().UTC()
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", awsV4Algorithm)
+	query.Set("X-Amz-Credential", s.credentials.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(awsV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if s.credentials.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.credentials.SessionToken)
+	}
+	u.RawQuery = awsV4CanonicalQuery(query)
+
+	canonicalHeaders := "host:" + u.Host + "\n"
+
+	signature := s.signature(now, awsV4CanonicalRequest(method, u, s.service, canonicalHeaders, "host", awsV4UnsignedPayload))
+
+	u.RawQuery += "&X-Amz-Signature=" + signature
+
+	return u.String(), nil
+}
+
+func (s *AWSv4Signer) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(awsV4DateFormat), s.region, s.service, "aws4_request"}, "/")
+}
+
+func (s *AWSv4Signer) signature(now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		awsV4Algorithm,
+		now.Format(awsV4TimeFormat),
+		s.scope(now),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.credentials.SecretAccessKey), now.Format(awsV4DateFormat))
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, s.service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+}
+
+func awsV4CanonicalRequest(method string, u *url.URL, service string, canonicalHeaders string, signedHeaders string, payloadHash string) string {
+	return strings.Join([]string{
+		method,
+		awsV4CanonicalURI(u, service),
+		awsV4CanonicalQuery(u.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+func awsV4CanonicalURI(u *url.URL, service string) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsURIEncode(segment)
+		if service != "s3" { // everyone else wants segments encoded twice
+			segments[i] = awsURIEncode(segments[i])
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func awsV4CanonicalQuery(query url.Values) string {
+	pairs := []string{}
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key)+"="+awsURIEncode(value))
+		}
+	}
+	sort.Strings(pairs) // sorts by key, then by value since '=' sorts before all allowed chars
+
+	return strings.Join(pairs, "&")
+}
+
+// only signs headers that are not expected to be changed by proxies etc. in transit
+func awsV4CanonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{
+		"host": host,
+	}
+
+	for key, values := range req.Header {
+		lowerKey := strings.ToLower(key)
+
+		switch {
+		case lowerKey == "content-type", lowerKey == "content-md5", lowerKey == "range", strings.HasPrefix(lowerKey, "x-amz-"):
+			trimmed := []string{}
+			for _, value := range values {
+				trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+			}
+
+			headers[lowerKey] = strings.Join(trimmed, ",")
+		}
+	}
+
+	keys := []string{}
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	canonical := strings.Builder{}
+	for _, key := range keys {
+		canonical.WriteString(key + ":" + headers[key] + "\n")
+	}
+
+	return strings.Join(keys, ";"), canonical.String()
+}
+
+// RFC 3986 unreserved characters are left as-is, everything else is percent-encoded
+func awsURIEncode(s string) string {
+	encoded := strings.Builder{}
+	for _, b := range []byte(s) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (r roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r(req)
+}
@@ -0,0 +1,125 @@
+package ezhttp
+
+// Request body compression and response body decompression.
+//
+// Go's transport transparently decompresses gzip responses, but only when it added the
+// `Accept-Encoding` header by itself. When you set it yourself (f.ex. to also accept deflate)
+// you're on your own - unless you use us.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate" // in HTTP "deflate" means zlib-wrapped deflate (RFC 1950)
+)
+
+// compresses the request body (f.ex. given by SendJSON()). the server must support `Content-Encoding` in requests.
+func CompressRequest(encoding string) ConfigPiece {
+	return ConfigPiece{
+		BeforeInit: func(conf *Config) {
+			conf.RequestCompression = encoding
+		},
+	}
+}
+
+var CompressRequestGzip = CompressRequest(CompressionGzip)
+
+// asks server to compress the response. the response is decompressed for you.
+var AcceptCompressedResponse = Header("Accept-Encoding", CompressionGzip+", "+CompressionDeflate)
+
+// compresses whole body in memory so `Content-Length` is known (and the request can be retried)
+func compressRequestBody(body io.Reader, encoding string) (io.Reader, error) {
+	compressed := &bytes.Buffer{}
+
+	compressor, err := func() (io.WriteCloser, error) {
+		switch encoding {
+		case CompressionGzip:
+			return gzip.NewWriter(compressed), nil
+		case CompressionDeflate:
+			return zlib.NewWriter(compressed), nil
+		default:
+			return nil, fmt.Errorf("ezhttp: unsupported request compression: %s", encoding)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(compressor, body); err != nil {
+		return nil, fmt.Errorf("ezhttp: compress request: %w", err)
+	}
+
+	if err := compressor.Close(); err != nil {
+		return nil, fmt.Errorf("ezhttp: compress request: %w", err)
+	}
+
+	return compressed, nil
+}
+
+// transparently decompresses the body if we explicitly asked for compressed content and the
+// transport didn't already decompress it
+func decompressResponseIfNeeded(resp *http.Response, req *http.Request) error {
+	if resp.Uncompressed || req.Header.Get("Accept-Encoding") == "" {
+		return nil
+	}
+
+	// these don't have a body, even if they have `Content-Encoding`
+	if req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != CompressionGzip && encoding != "x-gzip" && encoding != CompressionDeflate {
+		return nil // not compressed, or something the caller asked for and knows how to handle (like "br")
+	}
+
+	// empty body can't be decompressed (f.ex. error responses from proxies that copy the headers)
+	compressed := bufio.NewReader(resp.Body)
+	if _, err := compressed.Peek(1); err == io.EOF {
+		return nil
+	}
+
+	decompressor, err := func() (io.ReadCloser, error) {
+		if encoding == CompressionDeflate {
+			return zlib.NewReader(compressed)
+		} else {
+			return gzip.NewReader(compressed)
+		}
+	}()
+	if err != nil {
+		resp.Body.Close()
+		return fmt.Errorf("ezhttp: decompress response: %w", err)
+	}
+
+	resp.Body = &decompressingBody{decompressor, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return nil
+}
+
+type decompressingBody struct {
+	io.ReadCloser // the decompressor
+	compressed    io.ReadCloser
+}
+
+func (d *decompressingBody) Close() error {
+	errDecompressor := d.ReadCloser.Close()
+
+	if err := d.compressed.Close(); err != nil {
+		return err
+	}
+
+	return errDecompressor
+}
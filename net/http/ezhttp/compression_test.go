@@ -0,0 +1,148 @@
+package ezhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestCompressRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decompressor, err := func() (io.Reader, error) {
+			switch r.Header.Get("Content-Encoding") {
+			case "gzip":
+				return gzip.NewReader(r.Body)
+			case "deflate":
+				return zlib.NewReader(r.Body)
+			default:
+				return nil, errors.New("unexpected Content-Encoding")
+			}
+		}()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(decompressor)
+		fmt.Fprintf(w, "%s %s", r.Header.Get("Content-Encoding"), body)
+	}))
+	defer ts.Close()
+
+	for _, encoding := range []string{CompressionGzip, CompressionDeflate} {
+		resp, err := Post(context.Background(), ts.URL, SendJSON(ExampleJsonPayload{Hello: "world"}), CompressRequest(encoding))
+		assert.Ok(t, err)
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, string(body), encoding+` {"Hello":"world"}`)
+	}
+}
+
+func TestDecompressResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed := &bytes.Buffer{}
+		compressor := zlib.NewWriter(compressed)
+		fmt.Fprint(compressor, `{"Hello": "compressed world"}`)
+		_ = compressor.Close()
+
+		w.Header().Set("Content-Encoding", "deflate")
+		_, _ = w.Write(compressed.Bytes())
+	}))
+	defer ts.Close()
+
+	res := ExampleJsonPayload{}
+	_, err := Get(context.Background(), ts.URL, AcceptCompressedResponse, RespondsJSONDisallowUnknownFields(&res))
+	assert.Ok(t, err)
+	assert.Equal(t, res.Hello, "compressed world")
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked": // no Content-Length so limit can't be checked beforehand
+			w.(http.Flusher).Flush()
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+
+		fmt.Fprintf(w, `{"Hello": "%s"}`, strings.Repeat("a", 100))
+	}))
+	defer ts.Close()
+
+	tooLarge := func(err error) bool {
+		var errTooLarge *ResponseTooLargeError
+		return errors.As(err, &errTooLarge) && errTooLarge.Limit == 50
+	}
+
+	res := ExampleJsonPayload{}
+
+	for _, path := range []string{"/", "/chunked"} {
+		_, err := Get(context.Background(), ts.URL+path, MaxResponseBytes(50), RespondsJSONDisallowUnknownFields(&res))
+		assert.Equal(t, tooLarge(err), true)
+	}
+
+	// error's status is more useful than the size limit
+	_, err := Get(context.Background(), ts.URL+"/error", MaxResponseBytes(50))
+	assert.Equal(t, ErrorIs(err, http.StatusBadGateway), true)
+
+	// raw body read
+	resp, err := Get(context.Background(), ts.URL+"/chunked", MaxResponseBytes(50))
+	assert.Ok(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.Equal(t, tooLarge(err), true)
+	assert.Equal(t, len(body), 50)
+
+	// exactly at limit is ok
+	resp, err = Get(context.Background(), ts.URL+"/chunked", MaxResponseBytes(113))
+	assert.Ok(t, err)
+	body, err = io.ReadAll(resp.Body)
+	assert.Ok(t, err)
+	assert.Equal(t, len(body), 113)
+}
+
+func TestDecompressErrorResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/corrupt":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("not gzip, but long enough for a header"))
+		default:
+			_, _ = w.Write([]byte("not gzip"))
+		}
+	}))
+	defer ts.Close()
+
+	statusCode := func(err error) int {
+		var errStatus *ResponseStatusError
+		if !errors.As(err, &errStatus) {
+			return 0
+		}
+		return errStatus.StatusCode()
+	}
+
+	_, err := Get(context.Background(), ts.URL+"/empty", AcceptCompressedResponse)
+	assert.Equal(t, statusCode(err), http.StatusServiceUnavailable)
+
+	_, err = Get(context.Background(), ts.URL+"/corrupt", AcceptCompressedResponse)
+	assert.Equal(t, statusCode(err), http.StatusInternalServerError)
+	assert.Matches(t, err.Error(), "500 Internal Server Error; ezhttp: decompress response: .+")
+	assert.Equal(t, errors.Is(err, gzip.ErrHeader), true)
+
+	// for successful responses the decompression error is the error
+	_, err = Get(context.Background(), ts.URL+"/ok", AcceptCompressedResponse)
+	assert.Equal(t, statusCode(err), 0)
+	assert.Matches(t, err.Error(), "ezhttp: decompress response: .+")
+}
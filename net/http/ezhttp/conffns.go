@@ -78,6 +78,14 @@ func respondsJSON(ref interface{}, allowUnknownFields bool) ConfigPiece {
 	})
 }
 
+// limits how big response body we're willing to read (applies to both JSON decoding and raw
+// body reads). exceeding it yields *ResponseTooLargeError. use this when calling untrusted endpoints.
+func MaxResponseBytes(limit int64) ConfigPiece {
+	return After(func(conf *Config) {
+		conf.MaxResponseBytes = limit
+	})
+}
+
 func Client(client *http.Client) ConfigPiece {
 	return After(func(conf *Config) {
 		conf.Client = client
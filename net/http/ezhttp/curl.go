@@ -0,0 +1,342 @@
+package ezhttp
+
+// Import of curl command lines (e.g. browser dev tools' "copy as cURL") so they can be turned into
+// test code. The reverse direction is Config.CURLEquivalent().
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// result of parsing a curl command line
+type CURLCommand struct {
+	Method       string
+	URL          string
+	ConfigPieces []ConfigPiece
+}
+
+// prepares the parsed request (without sending it). *confPieces* are applied after the parsed ones.
+func (c *CURLCommand) NewRequest(ctx context.Context, confPieces ...ConfigPiece) *Config {
+	return newRequest(ctx, c.Method, c.URL, append(append([]ConfigPiece{}, c.ConfigPieces...), confPieces...)...)
+}
+
+// parses a curl command line (as you'd paste it to a shell, including quoting and line
+// continuations) into request method, URL and ConfigPieces.
+//
+// only flags that affect the request are supported. unknown flags are an error so that you
+// don't silently end up with a different request.
+func ParseCURL(commandLine string) (*CURLCommand, error) {
+	withErr := func(err error) (*CURLCommand, error) { return nil, fmt.Errorf("ParseCURL: %w", err) }
+
+	args, err := shellSplit(commandLine)
+	if err != nil {
+		return withErr(err)
+	}
+
+	if len(args) == 0 || args[0] != "curl" {
+		return withErr(errors.New("command line does not start with 'curl'"))
+	}
+
+	method := ""
+	url := ""
+	headers := [][2]string{}
+	dataParts := []string{}
+	hasData := false
+	head := false
+	insecure := false
+	basicAuth := ""
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if url != "" {
+				return withErr(fmt.Errorf("multiple URLs: %s, %s", url, arg))
+			}
+			url = arg
+			continue
+		}
+
+		// support "--header=value" form
+		flag, inlineValue, hasInlineValue := strings.Cut(arg, "=")
+		if !strings.HasPrefix(flag, "--") {
+			flag, hasInlineValue = arg, false
+		}
+
+		value := func() (string, error) {
+			if hasInlineValue {
+				return inlineValue, nil
+			}
+
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("flag %s requires a value", flag)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch flag {
+		case "-X", "--request":
+			method, err = value()
+		case "-H", "--header":
+			var header string
+			header, err = value()
+			if err == nil {
+				key, val, found := strings.Cut(header, ":")
+				if !found {
+					return withErr(fmt.Errorf("malformed header: %s", header))
+				}
+				headers = append(headers, [2]string{strings.TrimSpace(key), strings.TrimSpace(val)})
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw":
+			var data string
+			data, err = value()
+			if err == nil {
+				if strings.HasPrefix(data, "@") && flag != "--data-raw" {
+					return withErr(fmt.Errorf("%s: reading data from file not supported", flag))
+				}
+				if flag != "--data-binary" && flag != "--data-raw" { // curl strips newlines from these
+					data = strings.NewReplacer("\r", "", "\n", "").Replace(data)
+				}
+				dataParts = append(dataParts, data)
+				hasData = true
+			}
+		case "-u", "--user":
+			basicAuth, err = value()
+		case "-b", "--cookie":
+			var cookie string
+			cookie, err = value()
+			headers = append(headers, [2]string{"Cookie", cookie})
+		case "-A", "--user-agent":
+			var userAgent string
+			userAgent, err = value()
+			headers = append(headers, [2]string{"User-Agent", userAgent})
+		case "-e", "--referer":
+			var referer string
+			referer, err = value()
+			headers = append(headers, [2]string{"Referer", referer})
+		case "--url":
+			url, err = value()
+		case "-I", "--head":
+			head = true
+		case "-k", "--insecure":
+			insecure = true
+		case "--compressed", "-s", "--silent", "-S", "--show-error", "-sS", "-L", "--location", "-i", "--include", "-v", "--verbose", "-g", "--globoff":
+			// don't affect the request itself (or Go's client does it anyway, like decompression)
+		default:
+			return withErr(fmt.Errorf("unsupported flag: %s", arg))
+		}
+
+		if err != nil {
+			return withErr(err)
+		}
+	}
+
+	if url == "" {
+		return withErr(errors.New("no URL"))
+	}
+
+	if method == "" {
+		switch {
+		case head:
+			method = http.MethodHead
+		case hasData:
+			method = http.MethodPost
+		default:
+			method = http.MethodGet
+		}
+	}
+
+	pieces := []ConfigPiece{}
+
+	if hasData {
+		body := strings.Join(dataParts, "&") // curl joins multiple data flags like this
+		pieces = append(pieces, ConfigPiece{
+			BeforeInit: func(conf *Config) { // new reader each time so the command can be used many times
+				conf.RequestBody = strings.NewReader(body)
+			},
+			AfterInit: func(conf *Config) { // curl's default. explicit header (below) overrides this
+				conf.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			},
+		})
+	}
+
+	if basicAuth != "" {
+		username, password, _ := strings.Cut(basicAuth, ":")
+		pieces = append(pieces, AuthBasic(username, password))
+	}
+
+	if insecure {
+		pieces = append(pieces, Client(InsecureTlsClient))
+	}
+
+	// first occurrence of a header replaces any default, subsequent ones add to it
+	seenHeaders := map[string]bool{}
+	for _, header := range headers {
+		key, val := header[0], header[1]
+		replace := !seenHeaders[http.CanonicalHeaderKey(key)]
+		seenHeaders[http.CanonicalHeaderKey(key)] = true
+
+		pieces = append(pieces, After(func(conf *Config) {
+			if replace {
+				conf.Request.Header.Set(key, val)
+			} else {
+				conf.Request.Header.Add(key, val)
+			}
+		}))
+	}
+
+	return &CURLCommand{
+		Method:       method,
+		URL:          url,
+		ConfigPieces: pieces,
+	}, nil
+}
+
+// splits a command line into arguments like a POSIX shell would. supports single quotes,
+// double quotes, backslash escapes (incl. line continuations) and Bash's $'...' ANSI-C quoting
+// (which browsers use in "copy as cURL").
+func shellSplit(commandLine string) ([]string, error) {
+	args := []string{}
+	current := strings.Builder{}
+	inArg := false
+
+	endArg := func() {
+		if inArg {
+			args = append(args, current.String())
+			current.Reset()
+			inArg = false
+		}
+	}
+
+	input := []rune(commandLine)
+
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			endArg()
+		case ch == '\\':
+			if i+1 >= len(input) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			if input[i] == '\n' { // line continuation
+				continue
+			}
+			current.WriteRune(input[i])
+			inArg = true
+		case ch == '\'':
+			end := indexRune(input, '\'', i+1)
+			if end == -1 {
+				return nil, errors.New("unterminated single quote")
+			}
+			current.WriteString(string(input[i+1 : end]))
+			inArg = true
+			i = end
+		case ch == '"':
+			i++
+			for ; i < len(input) && input[i] != '"'; i++ {
+				// inside double quotes backslash only escapes these
+				if input[i] == '\\' && i+1 < len(input) && strings.ContainsRune("$`\"\\\n", input[i+1]) {
+					i++
+					if input[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteRune(input[i])
+			}
+			if i >= len(input) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inArg = true
+		case ch == '$' && i+1 < len(input) && input[i+1] == '\'':
+			end, err := ansiCQuoted(input, i+2, &current)
+			if err != nil {
+				return nil, err
+			}
+			inArg = true
+			i = end
+		default:
+			current.WriteRune(ch)
+			inArg = true
+		}
+	}
+
+	endArg()
+
+	return args, nil
+}
+
+// processes $'...' quoted string contents starting from *start* into *out*. returns index of the closing quote.
+func ansiCQuoted(input []rune, start int, out *strings.Builder) (int, error) {
+	for i := start; i < len(input); i++ {
+		switch input[i] {
+		case '\'':
+			return i, nil
+		case '\\':
+			if i+1 >= len(input) {
+				return -1, errors.New("unterminated $' quote")
+			}
+			i++
+
+			switch esc := input[i]; esc {
+			case 'n':
+				out.WriteRune('\n')
+			case 't':
+				out.WriteRune('\t')
+			case 'r':
+				out.WriteRune('\r')
+			case '\\', '\'', '"', '?':
+				out.WriteRune(esc)
+			case 'x', 'u', 'U':
+				maxDigits := map[rune]int{'x': 2, 'u': 4, 'U': 8}[esc]
+
+				digits := 0
+				for digits < maxDigits && i+1+digits < len(input) && strings.ContainsRune("0123456789abcdefABCDEF", input[i+1+digits]) {
+					digits++
+				}
+				if digits == 0 {
+					return -1, fmt.Errorf("invalid \\%c escape", esc)
+				}
+
+				code, err := strconv.ParseUint(string(input[i+1:i+1+digits]), 16, 32)
+				if err != nil {
+					return -1, err
+				}
+				i += digits
+
+				if esc == 'x' { // a raw byte
+					out.WriteByte(byte(code))
+				} else if r := rune(code); utf8.ValidRune(r) {
+					out.WriteRune(r)
+				} else {
+					return -1, fmt.Errorf("invalid code point: %x", code)
+				}
+			default:
+				out.WriteRune('\\')
+				out.WriteRune(esc)
+			}
+		default:
+			out.WriteRune(input[i])
+		}
+	}
+
+	return -1, errors.New("unterminated $' quote")
+}
+
+func indexRune(input []rune, r rune, start int) int {
+	for i := start; i < len(input); i++ {
+		if input[i] == r {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,75 @@
+package ezhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/function61/gokit/builtin"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestParseCURL(t *testing.T) {
+	// like what browsers' "copy as cURL" produces
+	cmd, err := ParseCURL(`curl 'https://example.net/api/items?page=2' \
+  -H 'accept: application/json' \
+  -H $'x-note: it\'s ä' \
+  -b 'session=abc; theme=dark' \
+  --data-raw '{"name":"foo"}' \
+  --compressed`)
+	assert.Ok(t, err)
+
+	assert.Equal(t, cmd.Method, http.MethodPost)
+	assert.Equal(t, cmd.URL, "https://example.net/api/items?page=2")
+
+	req := cmd.NewRequest(context.Background(), Header("Content-Type", "application/json")).Request
+
+	assert.Equal(t, req.Header.Get("Accept"), "application/json")
+	assert.Equal(t, req.Header.Get("X-Note"), "it's ä")
+	assert.Equal(t, req.Header.Get("Cookie"), "session=abc; theme=dark")
+	assert.Equal(t, req.Header.Get("Content-Type"), "application/json")
+
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, string(body), `{"name":"foo"}`)
+}
+
+func TestParseCURLRoundTrip(t *testing.T) {
+	original := NewPut(
+		context.Background(),
+		"https://example.net/hello?a=1&b=2",
+		SendBody(strings.NewReader("line1\nit's \"quoted\" $HOME"), "text/plain"),
+		AuthBasic("AzureDiamond", "hunter2"),
+		Header("X-Multi", "one"),
+		Client(InsecureTlsClient))
+
+	commandLine := Must(original.CURLEquivalentShell())
+
+	cmd, err := ParseCURL(commandLine)
+	assert.Ok(t, err)
+
+	reconstructed := cmd.NewRequest(context.Background())
+
+	assert.Equal(t, Must(reconstructed.CURLEquivalentShell()), commandLine)
+	assert.Equal(t, reconstructed.Client, InsecureTlsClient)
+}
+
+func TestParseCURLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		errMsg string
+	}{
+		{"wget https://example.net/", "ParseCURL: command line does not start with 'curl'"},
+		{"curl", "ParseCURL: no URL"},
+		{"curl --upload-file foo https://example.net/", "ParseCURL: unsupported flag: --upload-file"},
+		{"curl -d @payload.json https://example.net/", "ParseCURL: -d: reading data from file not supported"},
+		{"curl 'https://example.net/", "ParseCURL: unterminated single quote"},
+		{"curl -H", "ParseCURL: flag -H requires a value"},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := ParseCURL(tc.input)
+			assert.Equal(t, err.Error(), tc.errMsg)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package ezhttp
+
+// Resumable, verified downloads to disk.
+//
+// Like with osutil.WriteFileAtomic(), the content is written to <path>.part which is only renamed to
+// <path> when the download completes (and passes verification), so partial files never appear at
+// the destination. Unlike WriteFileAtomic(), the .part file is kept on (non-verification) errors
+// so a later call can resume with `Range` request. `If-Range` makes sure we don't resume on top
+// of an older version of the file. That is also why we don't use WriteFileAtomic() itself: it
+// removes the .part file on any error.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/function61/gokit/io/hashverifyreader"
+)
+
+type DownloadProgress struct {
+	Downloaded int64 // including the bytes from a resumed partial download
+	Total      int64 // -1 if unknown
+}
+
+type DownloadOption func(opts *downloadOptions)
+
+type downloadOptions struct {
+	hash         hash.Hash
+	expectedHash []byte
+	progress     func(DownloadProgress)
+	confPieces   []ConfigPiece
+}
+
+// verifies digest of the whole file (f.ex. `sha256.New()`). if it doesn't match, the partial download is discarded.
+// *hash* is reset at the start of each call, so the same options can be used to retry.
+func DownloadVerifyDigest(hash hash.Hash, expected []byte) DownloadOption {
+	return func(opts *downloadOptions) {
+		opts.hash = hash
+		opts.expectedHash = expected
+	}
+}
+
+// *progress* is called from the downloading goroutine, so it should be fast
+func DownloadReportProgress(progress func(DownloadProgress)) DownloadOption {
+	return func(opts *downloadOptions) {
+		opts.progress = progress
+	}
+}
+
+// customize the request (f.ex. auth)
+func DownloadConfig(confPieces ...ConfigPiece) DownloadOption {
+	return func(opts *downloadOptions) {
+		opts.confPieces = append(opts.confPieces, confPieces...)
+	}
+}
+
+// downloads *url* into *path*. resumes from an earlier interrupted call if possible.
+//
+// NOTE: not safe for concurrent downloads to the same path.
+func DownloadFile(ctx context.Context, url string, path string, options ...DownloadOption) error {
+	withErr := func(err error) error { return fmt.Errorf("DownloadFile: %w", err) }
+
+	opts := downloadOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	partPath := path + ".part"
+	validatorPath := partPath + ".validator" // ETag or Last-Modified of the partial content
+
+	discardPartial := func() {
+		_ = os.Remove(partPath)
+		_ = os.Remove(validatorPath)
+	}
+
+	resumeFrom, validator := downloadResumeState(partPath, validatorPath)
+
+	confPieces := append([]ConfigPiece{}, opts.confPieces...)
+	if resumeFrom > 0 {
+		confPieces = append(confPieces,
+			Header("Range", fmt.Sprintf("bytes=%d-", resumeFrom)),
+			// server will send whole content (200) if the content has changed
+			Header("If-Range", validator))
+	}
+
+	resp, err := Get(ctx, url, append(confPieces, TolerateNon2xxResponse)...)
+	if err != nil {
+		return withErr(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resumeFrom > 0:
+		if start := contentRangeStart(resp.Header.Get("Content-Range")); start != resumeFrom {
+			return withErr(fmt.Errorf("unexpected Content-Range: %s", resp.Header.Get("Content-Range")))
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resumeFrom > 0:
+		// partial file is somehow bigger than the content. start over.
+		discardPartial()
+		return DownloadFile(ctx, url, path, options...)
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		resumeFrom = 0 // got whole content
+	default:
+		return withErr(errorFromResponse(resp, DecodeProblemJSON))
+	}
+
+	partFile, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return withErr(err)
+	}
+	defer partFile.Close()
+
+	if err := partFile.Truncate(resumeFrom); err != nil { // no-op for resume, clears old content if starting over
+		return withErr(err)
+	}
+
+	if err := writeDownloadValidator(validatorPath, resp.Header); err != nil {
+		return withErr(err)
+	}
+
+	body := io.Reader(resp.Body)
+
+	if opts.hash != nil {
+		opts.hash.Reset() // might have state from an earlier (interrupted) call with the same options
+
+		// hash has to cover the content we already have
+		if _, err := io.Copy(opts.hash, io.NewSectionReader(partFile, 0, resumeFrom)); err != nil {
+			return withErr(err)
+		}
+
+		body = hashverifyreader.New(body, opts.hash, opts.expectedHash)
+	}
+
+	if _, err := partFile.Seek(resumeFrom, io.SeekStart); err != nil {
+		return withErr(err)
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = resumeFrom + resp.ContentLength
+	}
+
+	if _, err := io.Copy(partFile, &progressReader{
+		reader:   body,
+		progress: DownloadProgress{Downloaded: resumeFrom, Total: total},
+		report:   opts.progress,
+	}); err != nil {
+		if opts.hash != nil && errors.Is(err, hashverifyreader.ErrDigestMismatch) {
+			partFile.Close()
+			discardPartial() // resuming corrupted content would be pointless
+		}
+
+		return withErr(err)
+	}
+
+	// `Close()` alone doesn't guarantee that the data has been successfully saved to disk.
+	if err := partFile.Sync(); err != nil {
+		return withErr(err)
+	}
+
+	if err := partFile.Close(); err != nil { // double close intentional
+		return withErr(err)
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		return withErr(err)
+	}
+
+	_ = os.Remove(validatorPath)
+
+	return nil
+}
+
+// returns (0, "") if there is nothing to resume from
+func downloadResumeState(partPath string, validatorPath string) (int64, string) {
+	partInfo, err := os.Stat(partPath)
+	if err != nil || partInfo.Size() == 0 {
+		return 0, ""
+	}
+
+	validator, err := os.ReadFile(validatorPath)
+	if err != nil || len(validator) == 0 { // without a validator we can't know if it's the same content
+		return 0, ""
+	}
+
+	return partInfo.Size(), string(validator)
+}
+
+func writeDownloadValidator(validatorPath string, header http.Header) error {
+	// weak ETags can't be used with If-Range
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+
+	if validator == "" { // download can't be safely resumed
+		if err := os.Remove(validatorPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	return os.WriteFile(validatorPath, []byte(validator), 0666)
+}
+
+// "bytes 100-199/200" => 100. -1 if unparseable
+func contentRangeStart(contentRange string) int64 {
+	rangeSpec, found := strings.CutPrefix(contentRange, "bytes ")
+	if !found {
+		return -1
+	}
+
+	startStr, _, found := strings.Cut(rangeSpec, "-")
+	if !found {
+		return -1
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return start
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress DownloadProgress
+	report   func(DownloadProgress)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.reader.Read(buf)
+	if n > 0 && p.report != nil {
+		p.progress.Downloaded += int64(n)
+		p.report(p.progress)
+	}
+
+	return n, err
+}
@@ -0,0 +1,128 @@
+package ezhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/io/hashverifyreader"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestDownloadFileResumes(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	contentDigest := sha256.Sum256(content)
+
+	requestedRanges := []string{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedRanges = append(requestedRanges, r.Header.Get("Range"))
+
+		w.Header().Set("ETag", `"v1"`)
+
+		if len(requestedRanges) == 1 { // first attempt gets interrupted halfway
+			w.Header().Set("Content-Length", "10000")
+			_, _ = w.Write(content[:4000])
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "release.bin")
+
+	progress := []DownloadProgress{}
+	options := []DownloadOption{
+		DownloadVerifyDigest(sha256.New(), contentDigest[:]),
+		DownloadReportProgress(func(p DownloadProgress) {
+			progress = append(progress, p)
+		}),
+	}
+
+	err := DownloadFile(context.Background(), ts.URL, path, options...)
+	assert.Equal(t, err != nil, true)
+
+	// partial content never appears at destination
+	_, err = os.Stat(path)
+	assert.Equal(t, os.IsNotExist(err), true)
+
+	partInfo, err := os.Stat(path + ".part")
+	assert.Ok(t, err)
+	assert.Equal(t, partInfo.Size(), int64(4000))
+
+	progress = nil
+
+	assert.Ok(t, DownloadFile(context.Background(), ts.URL, path, options...))
+
+	downloaded, err := os.ReadFile(path)
+	assert.Ok(t, err)
+	assert.Equal(t, string(downloaded), string(content))
+	assert.Equal(t, strings.Join(requestedRanges, ","), ",bytes=4000-")
+
+	lastProgress := progress[len(progress)-1]
+	assert.Equal(t, lastProgress.Downloaded, int64(10000))
+	assert.Equal(t, lastProgress.Total, int64(10000))
+
+	// bookkeeping files were cleaned up
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Ok(t, err)
+	assert.Equal(t, len(entries), 1)
+}
+
+func TestDownloadFileContentChangedWhileInterrupted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("new content"))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "release.bin")
+
+	// leftovers from interrupted download of previous version
+	assert.Ok(t, os.WriteFile(path+".part", []byte("old"), 0600))
+	assert.Ok(t, os.WriteFile(path+".part.validator", []byte(`"v1"`), 0600))
+
+	assert.Ok(t, DownloadFile(context.Background(), ts.URL, path))
+
+	downloaded, err := os.ReadFile(path)
+	assert.Ok(t, err)
+	assert.Equal(t, string(downloaded), "new content")
+}
+
+func TestDownloadFileDigestMismatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tampered content"))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "release.bin")
+
+	expectedDigest := sha256.Sum256([]byte("original content"))
+
+	err := DownloadFile(context.Background(), ts.URL, path, DownloadVerifyDigest(sha256.New(), expectedDigest[:]))
+	assert.Equal(t, errors.Is(err, hashverifyreader.ErrDigestMismatch), true)
+
+	for _, shouldNotExist := range []string{path, path + ".part"} {
+		_, err := os.Stat(shouldNotExist)
+		assert.Equal(t, os.IsNotExist(err), true)
+	}
+}
+
+func TestDownloadFileHTTPError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	err := DownloadFile(context.Background(), ts.URL, filepath.Join(t.TempDir(), "release.bin"))
+	assert.Equal(t, err.Error(), "DownloadFile: 404 Not Found; 404 page not found\n")
+}
@@ -13,7 +13,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/function61/gokit/net/http/tracecontext"
 )
 
 var (
@@ -47,11 +50,18 @@ type Config struct {
 	OutputsJson                   bool
 	OutputsJsonRef                interface{}
 	OutputsJsonAllowUnknownFields bool
+	ProblemDecoder                ProblemDecoder                              // for structured errors from non-2xx responses
+	MaxResponseBytes              int64                                       // 0 = no limit
+	RequestCompression            string                                      // "" = no compression
+	TransportMiddlewares          []func(http.RoundTripper) http.RoundTripper // wrap Client's transport for this request only. first is outermost
+	UnixSocketPath                string                                      // "" = connect normally
 }
 
 type ResponseStatusError struct {
 	error
 	statusCode int
+	header     http.Header
+	problem    *ProblemDetails
 }
 
 // returns the (non-2xx) status code that caused the error
@@ -59,6 +69,25 @@ func (e ResponseStatusError) StatusCode() int {
 	return e.statusCode
 }
 
+// returns the headers of the response, so you can read f.ex. `Retry-After` or rate limit headers
+func (e ResponseStatusError) Header() http.Header {
+	return e.header
+}
+
+// returns nil if the response was not a (decodable) problem details response
+func (e ResponseStatusError) Problem() *ProblemDetails {
+	return e.problem
+}
+
+// makes `errors.As(err, &problem)` work, and `errors.Is()` reach the cause (f.ex. decompression error)
+func (e ResponseStatusError) Unwrap() []error {
+	if e.problem == nil {
+		return []error{e.error}
+	}
+
+	return []error{e.error, e.problem}
+}
+
 // returns *ResponseStatusError as error if non-2xx response (unless TolerateNon2xxResponse()).
 // error is not *ResponseStatusError for transport-level errors, content (JSON) marshaling errors etc
 func Get(ctx context.Context, url string, confPieces ...ConfigPiece) (*http.Response, error) {
@@ -89,9 +118,28 @@ func Del(ctx context.Context, url string, confPieces ...ConfigPiece) (*http.Resp
 	return newRequest(ctx, http.MethodDelete, url, confPieces...).Send()
 }
 
+// returns *ResponseStatusError as error if non-2xx response (unless TolerateNon2xxResponse()).
+// error is not *ResponseStatusError for transport-level errors, content (JSON) marshaling errors etc
+func Patch(ctx context.Context, url string, confPieces ...ConfigPiece) (*http.Response, error) {
+	return newRequest(ctx, http.MethodPatch, url, confPieces...).Send()
+}
+
+// returns *ResponseStatusError as error if non-2xx response (unless TolerateNon2xxResponse()).
+// error is not *ResponseStatusError for transport-level errors, content (JSON) marshaling errors etc
+func Options(ctx context.Context, url string, confPieces ...ConfigPiece) (*http.Response, error) {
+	return newRequest(ctx, http.MethodOptions, url, confPieces...).Send()
+}
+
+// same as Get(), Post() etc. but for any method. for `method` please use `net/http` "enum"
+// (quotes because it's not declared as such)
+func Do(ctx context.Context, method string, url string, confPieces ...ConfigPiece) (*http.Response, error) {
+	return newRequest(ctx, method, url, confPieces...).Send()
+}
+
 func newRequest(ctx context.Context, method string, url string, confPieces ...ConfigPiece) *Config {
 	conf := &Config{
-		Client: http.DefaultClient,
+		Client:         http.DefaultClient,
+		ProblemDecoder: DecodeProblemJSON,
 	}
 
 	withErr := func(err error) *Config {
@@ -119,6 +167,25 @@ func newRequest(ctx context.Context, method string, url string, confPieces ...Co
 		return withErr(fmt.Errorf("ezhttp: %s with non-nil body is usually a mistake", method))
 	}
 
+	if conf.RequestCompression != "" && conf.RequestBody != nil {
+		compressed, err := compressRequestBody(conf.RequestBody, conf.RequestCompression)
+		if err != nil {
+			return withErr(err)
+		}
+
+		conf.RequestBody = compressed
+	}
+
+	if strings.HasPrefix(url, unixSocketURLPrefix) {
+		sockPath, httpURL, err := parseUnixSocketURL(url)
+		if err != nil {
+			return withErr(err)
+		}
+
+		conf.UnixSocketPath = sockPath
+		url = httpURL
+	}
+
 	req, err := http.NewRequest(
 		method,
 		url,
@@ -129,6 +196,15 @@ func newRequest(ctx context.Context, method string, url string, confPieces ...Co
 
 	req = req.WithContext(ctx)
 
+	// propagate distributed request correlation. done before AfterInit so explicit headers win
+	if spanContext, found := tracecontext.FromContext(ctx); found {
+		tracecontext.Inject(req.Header, spanContext)
+	}
+
+	if conf.RequestCompression != "" && conf.RequestBody != nil {
+		req.Header.Set("Content-Encoding", conf.RequestCompression)
+	}
+
 	conf.Request = req
 
 	for _, configure := range confPieces {
@@ -138,6 +214,16 @@ func newRequest(ctx context.Context, method string, url string, confPieces ...Co
 		configure.AfterInit(conf)
 	}
 
+	// done last, so that it applies to whichever client the pieces ended up with
+	if conf.UnixSocketPath != "" {
+		client, err := clientForUnixSocket(conf.Client, conf.UnixSocketPath)
+		if err != nil {
+			return withErr(err)
+		}
+
+		conf.Client = client
+	}
+
 	return conf
 }
 
@@ -146,11 +232,24 @@ func (conf *Config) Send() (*http.Response, error) {
 		return nil, conf.Abort
 	}
 
-	resp, err := conf.Client.Do(conf.Request)
+	resp, err := conf.clientWithMiddlewares().Do(conf.Request)
 	if err != nil {
 		return resp, err // this is a transport-level error
 	}
 
+	if err := decompressResponseIfNeeded(resp, conf.Request); err != nil {
+		// for error responses the status is more useful than the decompression error
+		if !conf.TolerateNon2xxResponse && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+			return resp, &ResponseStatusError{
+				statusCode: resp.StatusCode,
+				header:     resp.Header,
+				error:      fmt.Errorf("%s; %w", resp.Status, err),
+			}
+		}
+
+		return resp, err
+	}
+
 	// 304 is an error unless caller is expecting such response by sending caching headers
 	if resp.StatusCode == http.StatusNotModified && conf.Request.Header.Get("If-None-Match") != "" {
 		return resp, nil
@@ -161,7 +260,18 @@ func (conf *Config) Send() (*http.Response, error) {
 		defer resp.Body.Close()
 
 		// TODO: if caller wants to process error herself, we need an opt-out for this mechanism
-		return resp, errorWithResponseBodySample(resp)
+		return resp, errorFromResponse(resp, conf.ProblemDecoder)
+	}
+
+	// after status handling, so that large error responses don't lose their status
+	// (`errorFromResponse()` has its own, smaller limit)
+	if conf.MaxResponseBytes > 0 {
+		if resp.ContentLength > conf.MaxResponseBytes { // fail fast if we already know
+			resp.Body.Close()
+			return resp, &ResponseTooLargeError{Limit: conf.MaxResponseBytes}
+		}
+
+		resp.Body = &maxBytesReader{body: resp.Body, remaining: conf.MaxResponseBytes, limit: conf.MaxResponseBytes}
 	}
 
 	if conf.OutputsJson {
@@ -180,24 +290,106 @@ func (conf *Config) Send() (*http.Response, error) {
 	return resp, nil
 }
 
-func errorWithResponseBodySample(resp *http.Response) error {
-	errContentSampleLength := 128
-	truncatedIndicator := ""
+func (conf *Config) clientWithMiddlewares() *http.Client {
+	if len(conf.TransportMiddlewares) == 0 {
+		return conf.Client
+	}
 
-	// .Body is documented as always non-nil
-	errContent, err := io.ReadAll(io.LimitReader(resp.Body, int64(errContentSampleLength)))
-	if err != nil {
-		errContent = []byte(fmt.Sprintf("<failed reading response body: %v>", err))
-	} else if len(errContent) == errContentSampleLength {
-		truncatedIndicator = ".."
+	transport := conf.Client.Transport
+	if transport == nil { // same as what `http.Client` does
+		transport = http.DefaultTransport
+	}
+
+	for i := len(conf.TransportMiddlewares) - 1; i >= 0; i-- {
+		transport = conf.TransportMiddlewares[i](transport)
+	}
+
+	client := *conf.Client // shallow copy so we don't mutate a possibly shared client
+	client.Transport = transport
+
+	return &client
+}
+
+// returned when the response body exceeds the limit given with MaxResponseBytes()
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("ezhttp: response body exceeds limit of %d bytes", e.Limit)
+}
+
+// like `http.MaxBytesReader()` but for responses
+type maxBytesReader struct {
+	body      io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, &ResponseTooLargeError{Limit: m.limit}
 	}
 
-	if len(errContent) == 0 {
-		errContent = []byte("<no response body>")
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// read one byte more than allowed so we can tell apart exactly-at-limit and over-limit
+	if int64(len(p))-1 > m.remaining {
+		p = p[:m.remaining+1]
+	}
+
+	n, err := m.body.Read(p)
+	if int64(n) <= m.remaining {
+		m.remaining -= int64(n)
+		return n, err
+	}
+
+	n = int(m.remaining)
+	m.remaining = -1
+
+	return n, &ResponseTooLargeError{Limit: m.limit}
+}
+
+func (m *maxBytesReader) Close() error {
+	return m.body.Close()
+}
+
+// structured problem details if the response has them, otherwise an error with sample of the response body
+func errorFromResponse(resp *http.Response, problemDecoder ProblemDecoder) error {
+	// large enough for any sane error document, but bounded in case of a misbehaving server
+	errContent, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		errContent = []byte(fmt.Sprintf("<failed reading response body: %v>", err))
+	} else if problemDecoder != nil {
+		// decode errors are ignored on purpose: the body sample is more useful for debugging than the decode error
+		if problem, _ := problemDecoder(resp.Header.Get("Content-Type"), errContent); problem != nil {
+			return &ResponseStatusError{
+				statusCode: resp.StatusCode,
+				header:     resp.Header,
+				problem:    problem,
+				error:      fmt.Errorf("%s; %s", resp.Status, problem.Error()),
+			}
+		}
 	}
 
 	return &ResponseStatusError{
 		statusCode: resp.StatusCode,
-		error:      fmt.Errorf("%s; %s%s", resp.Status, errContent, truncatedIndicator),
+		header:     resp.Header,
+		error:      fmt.Errorf("%s; %s", resp.Status, responseBodySample(errContent)),
+	}
+}
+
+func responseBodySample(content []byte) string {
+	errContentSampleLength := 128
+
+	switch {
+	case len(content) == 0:
+		return "<no response body>"
+	case len(content) > errContentSampleLength:
+		return string(content[:errContentSampleLength]) + ".."
+	default:
+		return string(content)
 	}
 }
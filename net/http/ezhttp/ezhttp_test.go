@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/function61/gokit/net/http/tracecontext"
 	"github.com/function61/gokit/testing/assert"
 )
 
@@ -249,3 +250,19 @@ func TestNoOpConfig(t *testing.T) {
 	respBody, _ := io.ReadAll(resp.Body)
 	assert.Equal(t, string(respBody), "hello world\n")
 }
+
+func TestTraceContextPropagation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Header.Get("traceparent"), r.Header.Get("tracestate"))
+	}))
+	defer ts.Close()
+
+	spanContext, err := tracecontext.Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "congo=t61rcWkgMzE")
+	assert.Ok(t, err)
+
+	resp, err := Get(tracecontext.WithSpan(context.TODO(), spanContext), ts.URL)
+	assert.Ok(t, err)
+
+	respBody, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, string(respBody), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 congo=t61rcWkgMzE")
+}
@@ -0,0 +1,283 @@
+// Programmable fake HTTP server for tests: declare the calls you expect and their canned
+// responses, then Verify() that exactly those calls were made.
+//
+//	srv := ezhttptest.NewServer()
+//	defer srv.Close()
+//
+//	srv.Expect(http.MethodPost, "/api/items").
+//		WithHeader("Authorization", "Bearer tOkEn").
+//		WithJSONBody(`{"name": "foo"}`).
+//		RespondJSON(http.StatusCreated, Item{ID: "123"})
+//
+//	... exercise code under test against srv.URL ...
+//
+//	srv.Verify(t)
+package ezhttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Server struct {
+	*httptest.Server
+	expectations []*Expectation
+	unexpected   []string // descriptions of calls that didn't match any expectation
+	mu           sync.Mutex
+}
+
+func NewServer() *Server {
+	srv := &Server{
+		expectations: []*Expectation{},
+		unexpected:   []string{},
+	}
+
+	srv.Server = httptest.NewServer(http.HandlerFunc(srv.handle))
+
+	return srv
+}
+
+// declares an expected call. *path* is matched against the URL path, or against path+query
+// if *path* contains "?". by default the call is expected exactly once (see Times()).
+//
+// expectations are matched in declaration order, so declaring multiple expectations for the same
+// call lets you sequence different responses for repeated calls.
+func (s *Server) Expect(method string, path string) *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expectation := &Expectation{
+		method:  method,
+		path:    path,
+		headers: http.Header{},
+		times:   1,
+		response: cannedResponse{
+			status: http.StatusOK,
+			header: http.Header{},
+		},
+		mu: &s.mu,
+	}
+
+	s.expectations = append(s.expectations, expectation)
+
+	return expectation
+}
+
+// fails the test if there were unexpected calls or if expected calls were not made
+func (s *Server) Verify(t testing.TB) {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	problems := append([]string{}, s.unexpected...)
+
+	for _, expectation := range s.expectations {
+		if expectation.calls < expectation.times {
+			problems = append(problems, fmt.Sprintf("unmet: %s (called %d/%d times)", expectation, expectation.calls, expectation.times))
+		}
+	}
+
+	if len(problems) > 0 {
+		t.Errorf("ezhttptest: %s", strings.Join(problems, "\n"))
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response, unexpected := s.match(r, body)
+	if response == nil {
+		http.Error(w, "ezhttptest: "+unexpected, http.StatusInternalServerError)
+		return
+	}
+
+	if response.delay > 0 {
+		select {
+		case <-time.After(response.delay):
+		case <-r.Context().Done(): // client gave up
+			return
+		}
+	}
+
+	for key, values := range response.header {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(response.status)
+	_, _ = w.Write(response.body)
+}
+
+// returns nil response (and the reason) if the call was unexpected. the response is a copy, so
+// it can be used without holding the lock.
+func (s *Server) match(r *http.Request, body []byte) (*cannedResponse, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mismatches := []string{}
+
+	for _, expectation := range s.expectations {
+		if expectation.calls >= expectation.times || !expectation.matchesRoute(r) {
+			continue
+		}
+
+		if mismatch := expectation.mismatch(r, body); mismatch != "" {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %s", expectation, mismatch))
+			continue
+		}
+
+		expectation.calls++
+
+		response := expectation.response
+		response.header = response.header.Clone()
+		return &response, ""
+	}
+
+	description := fmt.Sprintf("unexpected: %s %s", r.Method, r.URL.RequestURI())
+	if len(mismatches) > 0 {
+		description += " (" + strings.Join(mismatches, "; ") + ")"
+	}
+
+	s.unexpected = append(s.unexpected, description)
+
+	return nil, description
+}
+
+// setters are safe to call even while the server is handling requests
+type Expectation struct {
+	method   string
+	path     string
+	headers  http.Header
+	body     *string
+	jsonBody *interface{} // decoded, for semantic comparison
+	times    int
+	calls    int
+	response cannedResponse
+	mu       *sync.Mutex // server's, as the server reads expectations while handling requests
+}
+
+type cannedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	delay  time.Duration
+}
+
+func (e *Expectation) String() string {
+	return e.method + " " + e.path
+}
+
+func (e *Expectation) WithHeader(key string, value string) *Expectation {
+	return e.locked(func() { e.headers.Add(key, value) })
+}
+
+// body must be exactly this
+func (e *Expectation) WithBody(body string) *Expectation {
+	return e.locked(func() { e.body = &body })
+}
+
+// body must be JSON that is semantically equal (whitespace, key order etc. don't matter)
+func (e *Expectation) WithJSONBody(expectedJSON string) *Expectation {
+	var expected interface{}
+	if err := json.Unmarshal([]byte(expectedJSON), &expected); err != nil {
+		panic(fmt.Errorf("ezhttptest: WithJSONBody: %w", err))
+	}
+
+	return e.locked(func() { e.jsonBody = &expected })
+}
+
+// the call is expected exactly *n* times
+func (e *Expectation) Times(n int) *Expectation {
+	return e.locked(func() { e.times = n })
+}
+
+func (e *Expectation) Respond(statusCode int, contentType string, body string) *Expectation {
+	return e.locked(func() {
+		e.response.status = statusCode
+		e.response.header.Set("Content-Type", contentType)
+		e.response.body = []byte(body)
+	})
+}
+
+func (e *Expectation) RespondJSON(statusCode int, data interface{}) *Expectation {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		panic(fmt.Errorf("ezhttptest: RespondJSON: %w", err))
+	}
+
+	return e.Respond(statusCode, "application/json", string(jsonBytes))
+}
+
+func (e *Expectation) RespondStatus(statusCode int) *Expectation {
+	return e.locked(func() { e.response.status = statusCode })
+}
+
+func (e *Expectation) RespondHeader(key string, value string) *Expectation {
+	return e.locked(func() { e.response.header.Add(key, value) })
+}
+
+// delays the response (f.ex. for testing client timeouts)
+func (e *Expectation) Delay(delay time.Duration) *Expectation {
+	return e.locked(func() { e.response.delay = delay })
+}
+
+func (e *Expectation) locked(set func()) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	set()
+
+	return e
+}
+
+func (e *Expectation) matchesRoute(r *http.Request) bool {
+	if e.method != r.Method {
+		return false
+	}
+
+	if strings.Contains(e.path, "?") {
+		return e.path == r.URL.RequestURI()
+	} else {
+		return e.path == r.URL.Path
+	}
+}
+
+// returns "" if matches
+func (e *Expectation) mismatch(r *http.Request, body []byte) string {
+	for key, values := range e.headers {
+		if actual := strings.Join(r.Header.Values(key), ","); actual != strings.Join(values, ",") {
+			return fmt.Sprintf("header %s: exp=%s; got=%s", key, strings.Join(values, ","), actual)
+		}
+	}
+
+	if e.body != nil && *e.body != string(body) {
+		return fmt.Sprintf("body: exp=%s; got=%s", *e.body, body)
+	}
+
+	if e.jsonBody != nil {
+		var actual interface{}
+		if err := json.Unmarshal(body, &actual); err != nil {
+			return fmt.Sprintf("body: not JSON: %v", err)
+		}
+
+		if !reflect.DeepEqual(actual, *e.jsonBody) {
+			expected, _ := json.Marshal(*e.jsonBody)
+			return fmt.Sprintf("JSON body: exp=%s; got=%s", expected, bytes.TrimSpace(body))
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,125 @@
+package ezhttptest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/net/http/ezhttp"
+	"github.com/function61/gokit/testing/assert"
+)
+
+type item struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.Expect(http.MethodPost, "/api/items").
+		WithHeader("Authorization", "Bearer tOkEn").
+		WithJSONBody(`{ "name": "foo" }`).
+		RespondJSON(http.StatusCreated, item{ID: "123", Name: "foo"})
+
+	// sequenced responses for repeated calls
+	srv.Expect(http.MethodGet, "/api/items/123").RespondStatus(http.StatusServiceUnavailable)
+	srv.Expect(http.MethodGet, "/api/items/123").RespondJSON(http.StatusOK, item{ID: "123", Name: "foo"})
+	srv.Expect(http.MethodDelete, "/api/items/123?force=true").Times(2)
+
+	created, err := ezhttp.PostJSON[item, item](context.Background(), srv.URL+"/api/items", item{Name: "foo"}, ezhttp.DisallowUnknownFields, ezhttp.AuthBearer("tOkEn"))
+	assert.Ok(t, err)
+	assert.Equal(t, created.ID, "123")
+
+	_, err = ezhttp.GetJSON[item](context.Background(), srv.URL+"/api/items/123", ezhttp.DisallowUnknownFields)
+	assert.Equal(t, ezhttp.ErrorIs(err, http.StatusServiceUnavailable), true)
+
+	fetched, err := ezhttp.GetJSON[item](context.Background(), srv.URL+"/api/items/123", ezhttp.DisallowUnknownFields)
+	assert.Ok(t, err)
+	assert.Equal(t, fetched.Name, "foo")
+
+	for i := 0; i < 2; i++ {
+		_, err = ezhttp.Del(context.Background(), srv.URL+"/api/items/123?force=true")
+		assert.Ok(t, err)
+	}
+
+	srv.Verify(t)
+}
+
+func TestServerDelay(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.Expect(http.MethodGet, "/slow").Delay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := ezhttp.Get(ctx, srv.URL+"/slow")
+	assert.Matches(t, err.Error(), "context deadline exceeded")
+}
+
+// run with `-race`
+func TestServerExpectationChangedWhileServing(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	poll := srv.Expect(http.MethodGet, "/poll").Times(20)
+
+	pollingDone := make(chan error, 1)
+	go func() {
+		for i := 0; i < 20; i++ {
+			resp, err := ezhttp.Get(context.Background(), srv.URL+"/poll")
+			if err != nil {
+				pollingDone <- err
+				return
+			}
+			resp.Body.Close()
+		}
+
+		pollingDone <- nil
+	}()
+
+	poll.RespondHeader("X-Ready", "yes")
+
+	assert.Ok(t, <-pollingDone)
+
+	srv.Verify(t)
+}
+
+func TestServerVerifyFails(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.Expect(http.MethodPost, "/api/items").WithJSONBody(`{"name": "foo"}`)
+	srv.Expect(http.MethodGet, "/never-called").Times(2)
+
+	_, err := ezhttp.Post(context.Background(), srv.URL+"/api/items", ezhttp.SendJSON(item{Name: "bar"}))
+	assert.Matches(t, err.Error(), `^500 Internal Server Error; ezhttptest: unexpected: POST /api/items \(POST /api/items: JSON body: exp={"name":"foo"}; got={"name":"bar"}\)\n$`) // mismatch listed only once
+
+	_, err = ezhttp.Get(context.Background(), srv.URL+"/whatever")
+	assert.Equal(t, err != nil, true)
+
+	fake := &fakeT{TB: t}
+	srv.Verify(fake)
+
+	assert.Equal(t, fake.failure, `ezhttptest: unexpected: POST /api/items (POST /api/items: JSON body: exp={"name":"foo"}; got={"name":"bar"})
+unexpected: GET /whatever
+unmet: POST /api/items (called 0/1 times)
+unmet: GET /never-called (called 0/2 times)`)
+}
+
+// captures the failure instead of failing the actual test
+type fakeT struct {
+	testing.TB
+	failure string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failure = fmt.Sprintf(format, args...)
+}
@@ -1,10 +1,15 @@
 package ezhttp
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 const (
@@ -54,7 +59,23 @@ func NewDel(ctx context.Context, url string, confPieces ...ConfigPiece) *Config
 	return newRequest(ctx, http.MethodDelete, url, confPieces...)
 }
 
-// for `method` please use `net/http` "enum" (quotes because it's not declared as such)
+// same as the corresponding without "New" prefix, but just prepared the request configuration without sending it yet
+func NewPatch(ctx context.Context, url string, confPieces ...ConfigPiece) *Config {
+	return newRequest(ctx, http.MethodPatch, url, confPieces...)
+}
+
+// same as the corresponding without "New" prefix, but just prepared the request configuration without sending it yet
+func NewOptions(ctx context.Context, url string, confPieces ...ConfigPiece) *Config {
+	return newRequest(ctx, http.MethodOptions, url, confPieces...)
+}
+
+// same as the corresponding without "New" prefix, but just prepared the request configuration without sending it yet
+func NewDo(ctx context.Context, method string, url string, confPieces ...ConfigPiece) *Config {
+	return newRequest(ctx, method, url, confPieces...)
+}
+
+// returns curl command line arguments (argv, ready for `exec.Command()`) that would make the same request.
+// the body is read from the request but left intact so the request can still be sent.
 func (c *Config) CURLEquivalent() ([]string, error) {
 	if err := c.Abort; err != nil {
 		return nil, err
@@ -62,14 +83,109 @@ func (c *Config) CURLEquivalent() ([]string, error) {
 
 	req := c.Request // shorthand
 
-	cmd := []string{"curl", "--request=" + req.Method}
+	cmd := []string{"curl"}
+
+	switch req.Method {
+	case http.MethodGet: // curl's default
+	case http.MethodHead: // `--request HEAD` would make curl wait for a body that never comes
+		cmd = append(cmd, "--head")
+	default:
+		cmd = append(cmd, "--request", req.Method)
+	}
+
+	if c.Client != nil {
+		if transport, ok := c.Client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify {
+			cmd = append(cmd, "--insecure")
+		}
+	}
+
+	username, password, hasBasicAuth := req.BasicAuth()
+	if hasBasicAuth {
+		cmd = append(cmd, "--user", username+":"+password)
+	}
+
+	headerKeys := []string{}
+	for key := range req.Header {
+		headerKeys = append(headerKeys, key)
+	}
+	sort.Strings(headerKeys) // Go's map iteration order is random
+
+	for _, key := range headerKeys {
+		if key == "Authorization" && hasBasicAuth { // already covered by `--user`
+			continue
+		}
+
+		for _, value := range req.Header[key] {
+			cmd = append(cmd, "--header", key+": "+value)
+		}
+	}
+
+	body, err := peekRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("CURLEquivalent: %w", err)
+	}
 
-	for key, values := range req.Header {
-		// FIXME: doesn't take into account multiple values
-		cmd = append(cmd, fmt.Sprintf("--header=%s=%s", key, values[0]))
+	if body != nil {
+		cmd = append(cmd, "--data-binary", string(body))
 	}
 
 	cmd = append(cmd, req.URL.String())
 
 	return cmd, nil
 }
+
+// same as CURLEquivalent() but as a single shell-quoted string that is safe to paste to a shell
+func (c *Config) CURLEquivalentShell() (string, error) {
+	cmd, err := c.CURLEquivalent()
+	if err != nil {
+		return "", err
+	}
+
+	quoted := []string{}
+	for _, arg := range cmd {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	return strings.Join(quoted, " "), nil
+}
+
+// reads the request body without consuming it (so the request can still be sent)
+func peekRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody == nil { // can't get a fresh copy => buffer it and arrange for one
+		content, err := drainBody(&req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}
+
+		return content, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+var shellSafeRe = regexp.MustCompile(`^[a-zA-Z0-9_./:=@%+,-]+$`)
+
+// single-quotes *arg* for POSIX shells unless it only contains characters that are safe as-is
+func shellQuote(arg string) string {
+	if shellSafeRe.MatchString(arg) {
+		return arg
+	}
+
+	// inside single quotes nothing is special, except the single quote itself which has to be
+	// done as: close quote, escaped quote, reopen quote
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -2,6 +2,7 @@ package ezhttp
 
 import (
 	"context"
+	"io"
 	"strings"
 	"testing"
 
@@ -12,5 +13,29 @@ import (
 func TestCURLEquivalent(t *testing.T) {
 	curlCmd := Must(NewPost(context.Background(), "https://example.net/hello", Header("x-correlation-id", "123")).CURLEquivalent())
 
-	assert.Equal(t, strings.Join(curlCmd, " "), "curl --request=POST --header=X-Correlation-Id=123 https://example.net/hello")
+	assert.Equal(t, strings.Join(curlCmd, " "), "curl --request POST --header X-Correlation-Id: 123 https://example.net/hello")
+}
+
+func TestCURLEquivalentShell(t *testing.T) {
+	req := NewPost(
+		context.Background(),
+		"https://example.net/hello?a=1&b=2",
+		SendBody(strings.NewReader(`{"msg": "it's"}`), "application/json"),
+		AuthBasic("AzureDiamond", "hunter2"),
+		Client(InsecureTlsClient),
+		After(func(conf *Config) {
+			conf.Request.Header.Add("Accept", "text/plain")
+			conf.Request.Header.Add("Accept", "text/html")
+		}))
+
+	assert.Equal(t, Must(req.CURLEquivalentShell()), `curl --request POST --insecure --user AzureDiamond:hunter2 --header 'Accept: text/plain' --header 'Accept: text/html' --header 'Content-Type: application/json' --data-binary '{"msg": "it'\''s"}' 'https://example.net/hello?a=1&b=2'`)
+
+	// body was not consumed
+	body, err := io.ReadAll(req.Request.Body)
+	assert.Ok(t, err)
+	assert.Equal(t, string(body), `{"msg": "it's"}`)
+}
+
+func TestCURLEquivalentHead(t *testing.T) {
+	assert.Equal(t, Must(NewHead(context.Background(), "https://example.net/").CURLEquivalentShell()), "curl --head https://example.net/")
 }
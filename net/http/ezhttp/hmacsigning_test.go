@@ -0,0 +1,64 @@
+package ezhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestHMACSigning(t *testing.T) {
+	ts := httptest.NewServer(HMACVerifierMiddleware("s3cret", time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "verified %s", body)
+	})))
+	defer ts.Close()
+
+	resp, err := Post(context.Background(), ts.URL+"/hello?foo=bar", SendBody(strings.NewReader("payload"), "text/plain"), SignHMAC("s3cret"))
+	assert.Ok(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, string(body), "verified payload")
+
+	_, err = Post(context.Background(), ts.URL+"/hello", SendBody(strings.NewReader("payload"), "text/plain"), SignHMAC("wrong"))
+	assert.Equal(t, err.Error(), "401 Unauthorized; MAC validation failed\n")
+
+	_, err = Post(context.Background(), ts.URL+"/hello", SendBody(strings.NewReader("payload"), "text/plain"))
+	assert.Equal(t, err.Error(), "401 Unauthorized; request not signed\n")
+}
+
+func TestHMACVerifierBodyLimit(t *testing.T) {
+	ts := httptest.NewServer(HMACVerifierMiddlewareLimit("s3cret", time.Minute, 10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "verified")
+	})))
+	defer ts.Close()
+
+	_, err := Post(context.Background(), ts.URL, SendBody(strings.NewReader("small"), "text/plain"), SignHMAC("s3cret"))
+	assert.Ok(t, err)
+
+	_, err = Post(context.Background(), ts.URL, SendBody(strings.NewReader("more than ten bytes"), "text/plain"), SignHMAC("s3cret"))
+	assert.Equal(t, err.Error(), "413 Request Entity Too Large; http: request body too large\n")
+}
+
+func TestHMACVerifyRejectsTamperingAndOldSignatures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader("tampered"))
+	req.Header.Set(HMACTimestampHeader, "1700000000")
+	req.Header.Set(HMACSignatureHeader, hmacSignature("s3cret", req, "1700000000", []byte("original")).Sign())
+
+	assert.Equal(t, verifyHMAC("s3cret", time.Minute, req, now).Error(), "MAC validation failed")
+
+	req = httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader("original"))
+	req.Header.Set(HMACTimestampHeader, "1700000000")
+	req.Header.Set(HMACSignatureHeader, hmacSignature("s3cret", req, "1700000000", []byte("original")).Sign())
+
+	assert.Ok(t, verifyHMAC("s3cret", time.Minute, req, now))
+	assert.Equal(t, verifyHMAC("s3cret", time.Minute, req, now.Add(2*time.Minute)).Error(), "signature timestamp outside of allowed clock skew")
+}
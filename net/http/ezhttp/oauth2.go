@@ -0,0 +1,239 @@
+package ezhttp
+
+// OAuth2 access token fetching for the "client credentials" and "refresh token" grants:
+// https://www.rfc-editor.org/rfc/rfc6749#section-4.4
+// https://www.rfc-editor.org/rfc/rfc6749#section-6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/function61/gokit/builtin"
+)
+
+type OAuth2Config struct {
+	TokenURL           string
+	ClientID           string
+	ClientSecret       string        // sent with HTTP basic auth. if empty, ClientID is sent in the body (public client)
+	Scopes             []string      // optional
+	TokenRequestConfig []ConfigPiece // customizes token endpoint requests, f.ex. Client()
+}
+
+// response from token endpoint
+type OAuth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"` // seconds
+	Scope        string `json:"scope,omitempty"`
+}
+
+// fetches access tokens and caches them until shortly before expiry. concurrent callers
+// needing a new token share one token request. safe for concurrent use.
+type OAuth2TokenSource struct {
+	conf         OAuth2Config
+	grantType    string
+	refreshToken string // only for refresh token grant. updated if the server rotates it
+
+	token       string
+	tokenExpiry time.Time // zero if token doesn't expire
+	mu          sync.Mutex
+
+	fetching chan Void // semaphore (capacity 1) for coalescing concurrent token fetches
+	now      func() time.Time
+}
+
+func NewOAuth2ClientCredentials(conf OAuth2Config) *OAuth2TokenSource {
+	return newOAuth2TokenSource(conf, "client_credentials", "")
+}
+
+func NewOAuth2RefreshToken(conf OAuth2Config, refreshToken string) *OAuth2TokenSource {
+	return newOAuth2TokenSource(conf, "refresh_token", refreshToken)
+}
+
+func newOAuth2TokenSource(conf OAuth2Config, grantType string, refreshToken string) *OAuth2TokenSource {
+	return &OAuth2TokenSource{
+		conf:         conf,
+		grantType:    grantType,
+		refreshToken: refreshToken,
+		fetching:     make(chan Void, 1),
+		now:          time.Now,
+	}
+}
+
+// authenticates the request with an access token from *source*. if the server responds with 401,
+// the request is retried once with a fresh token (unless the request body can't be re-read).
+func AuthOAuth2(source *OAuth2TokenSource) ConfigPiece {
+	return After(func(conf *Config) {
+		conf.TransportMiddlewares = append(conf.TransportMiddlewares, func(inner http.RoundTripper) http.RoundTripper {
+			return &oauth2Transport{source, inner}
+		})
+	})
+}
+
+// returns a cached access token, or fetches a new one if needed
+func (o *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	if token := o.cachedToken(); token != "" {
+		return token, nil
+	}
+
+	select { // only one fetch in flight. others wait for it and then use its result
+	case o.fetching <- Void{}:
+		defer func() { <-o.fetching }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	if token := o.cachedToken(); token != "" { // someone else fetched it while we were waiting
+		return token, nil
+	}
+
+	return o.fetch(ctx)
+}
+
+// forgets the cached token if it's *token*, so the next Token() call fetches a new one.
+// (comparison so that concurrent invalidations of the same token don't discard the fresh token)
+func (o *OAuth2TokenSource) Invalidate(token string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token == token {
+		o.token = ""
+	}
+}
+
+func (o *OAuth2TokenSource) cachedToken() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != "" && (o.tokenExpiry.IsZero() || o.now().Before(o.tokenExpiry)) {
+		return o.token
+	}
+
+	return ""
+}
+
+func (o *OAuth2TokenSource) fetch(ctx context.Context) (string, error) {
+	withErr := func(err error) (string, error) { return "", fmt.Errorf("OAuth2 %s: %w", o.grantType, err) }
+
+	o.mu.Lock()
+	refreshToken := o.refreshToken
+	o.mu.Unlock()
+
+	form := url.Values{
+		"grant_type": {o.grantType},
+	}
+	if len(o.conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.conf.Scopes, " "))
+	}
+	if refreshToken != "" {
+		form.Set("refresh_token", refreshToken)
+	}
+
+	clientAuth := NoOpConfig
+	if o.conf.ClientSecret != "" {
+		// RFC says client ID and secret are form-encoded before basic auth encoding
+		clientAuth = AuthBasic(url.QueryEscape(o.conf.ClientID), url.QueryEscape(o.conf.ClientSecret))
+	} else {
+		form.Set("client_id", o.conf.ClientID)
+	}
+
+	token := OAuth2Token{}
+	if _, err := Post(ctx, o.conf.TokenURL, append([]ConfigPiece{
+		SendBody(strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"),
+		clientAuth,
+		RespondsJSONAllowUnknownFields(&token),
+	}, o.conf.TokenRequestConfig...)...); err != nil {
+		return withErr(err)
+	}
+
+	if token.AccessToken == "" {
+		return withErr(errors.New("no access_token in response"))
+	}
+
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "Bearer") {
+		return withErr(fmt.Errorf("unsupported token_type: %s", token.TokenType))
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.token = token.AccessToken
+	o.tokenExpiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+
+		// refresh a bit early so that the token doesn't expire while the request is in flight
+		margin := 30 * time.Second
+		if margin > lifetime/2 {
+			margin = lifetime / 2
+		}
+
+		o.tokenExpiry = o.now().Add(lifetime - margin)
+	}
+
+	if token.RefreshToken != "" { // server rotated the refresh token
+		o.refreshToken = token.RefreshToken
+	}
+
+	return token.AccessToken, nil
+}
+
+type oauth2Transport struct {
+	source *OAuth2TokenSource
+	inner  http.RoundTripper
+}
+
+func (o *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := o.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := o.inner.RoundTrip(withBearerToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if !canRetry {
+		return resp, nil
+	}
+
+	// token was probably revoked before its expiry => retry once with a fresh one
+	o.source.Invalidate(token)
+
+	freshToken, err := o.source.Token(req.Context())
+	if err != nil {
+		return resp, nil // the 401 is the more meaningful error to the caller
+	}
+
+	retry := withBearerToken(req, freshToken)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	// we're discarding the first response
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return o.inner.RoundTrip(retry)
+}
+
+// RoundTripper must not modify the given request
+func withBearerToken(req *http.Request, token string) *http.Request {
+	authenticated := req.Clone(req.Context())
+	authenticated.Header.Set("Authorization", "Bearer "+token)
+	return authenticated
+}
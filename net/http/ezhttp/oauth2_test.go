@@ -0,0 +1,181 @@
+package ezhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+type fakeOAuth2Server struct {
+	*httptest.Server
+	tokensIssued int64
+	validToken   atomic.Value // string
+}
+
+func newFakeOAuth2Server(t *testing.T) *fakeOAuth2Server {
+	srv := &fakeOAuth2Server{}
+	srv.validToken.Store("")
+
+	// handler runs outside of the test goroutine, so no asserts (they call `t.Fatalf()`). the
+	// error response also makes the client's request fail.
+	fail := func(w http.ResponseWriter, format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		t.Errorf("fake OAuth2 server: %s", msg)
+		http.Error(w, msg, http.StatusBadRequest)
+	}
+
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			clientID, clientSecret, _ := r.BasicAuth()
+			if clientID != "myclient" || clientSecret != "s3cret" {
+				http.Error(w, "bad client", http.StatusUnauthorized)
+				return
+			}
+
+			if err := r.ParseForm(); err != nil {
+				fail(w, "ParseForm: %v", err)
+				return
+			}
+
+			switch grant := r.PostForm.Get("grant_type"); grant {
+			case "client_credentials":
+				if scope := r.PostForm.Get("scope"); scope != "read write" {
+					fail(w, "unexpected scope: %s", scope)
+					return
+				}
+			case "refresh_token":
+				if refreshToken := r.PostForm.Get("refresh_token"); refreshToken != "refresh1" {
+					fail(w, "unexpected refresh_token: %s", refreshToken)
+					return
+				}
+			default:
+				fail(w, "unexpected grant: %s", grant)
+				return
+			}
+
+			time.Sleep(20 * time.Millisecond) // so concurrent requests pile up
+
+			token := fmt.Sprintf("token%d", atomic.AddInt64(&srv.tokensIssued, 1))
+			srv.validToken.Store(token)
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token": "%s", "token_type": "bearer", "expires_in": 3600}`, token)
+		case "/api":
+			if r.Header.Get("Authorization") != "Bearer "+srv.validToken.Load().(string) {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "hello %s", body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return srv
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	srv := newFakeOAuth2Server(t)
+	defer srv.Close()
+
+	source := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:     srv.URL + "/token",
+		ClientID:     "myclient",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+	})
+
+	call := func() (string, error) {
+		resp, err := Post(context.Background(), srv.URL+"/api", SendBody(strings.NewReader("world"), "text/plain"), AuthOAuth2(source))
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// concurrent requests share one token fetch. results are checked in the test goroutine.
+	bodies := make([]string, 10)
+	errs := make([]error, 10)
+
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i], errs[i] = call()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range bodies {
+		assert.Ok(t, errs[i])
+		assert.Equal(t, bodies[i], "hello world")
+	}
+
+	assert.Equal(t, atomic.LoadInt64(&srv.tokensIssued), int64(1))
+
+	// server revokes the token before its expiry => 401 => retried with a fresh token
+	srv.validToken.Store("")
+
+	body, err := call()
+	assert.Ok(t, err)
+	assert.Equal(t, body, "hello world")
+	assert.Equal(t, atomic.LoadInt64(&srv.tokensIssued), int64(2))
+}
+
+func TestOAuth2TokenExpiry(t *testing.T) {
+	srv := newFakeOAuth2Server(t)
+	defer srv.Close()
+
+	source := NewOAuth2RefreshToken(OAuth2Config{
+		TokenURL:     srv.URL + "/token",
+		ClientID:     "myclient",
+		ClientSecret: "s3cret",
+	}, "refresh1")
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token(context.Background())
+	assert.Ok(t, err)
+	assert.Equal(t, token, "token1")
+
+	now = now.Add(59 * time.Minute) // still cached
+	token, err = source.Token(context.Background())
+	assert.Ok(t, err)
+	assert.Equal(t, token, "token1")
+
+	now = now.Add(40 * time.Second) // within the safety margin before expiry
+	token, err = source.Token(context.Background())
+	assert.Ok(t, err)
+	assert.Equal(t, token, "token2")
+}
+
+func TestOAuth2BadClient(t *testing.T) {
+	srv := newFakeOAuth2Server(t)
+	defer srv.Close()
+
+	source := NewOAuth2ClientCredentials(OAuth2Config{
+		TokenURL:     srv.URL + "/token",
+		ClientID:     "myclient",
+		ClientSecret: "wrong",
+	})
+
+	_, err := Get(context.Background(), srv.URL+"/api", AuthOAuth2(source))
+	assert.Matches(t, err.Error(), "OAuth2 client_credentials: 401 Unauthorized; bad client")
+}
@@ -0,0 +1,146 @@
+package ezhttp
+
+// RFC 7807 "Problem Details for HTTP APIs" error responses: https://www.rfc-editor.org/rfc/rfc7807
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+const (
+	problemJSONContentType = "application/problem+json"
+)
+
+// machine-readable details of an error response. available from a non-2xx response error via
+// `errors.As(err, &problem)` (with `var problem *ProblemDetails`).
+type ProblemDetails struct {
+	Type       string                     // URI reference identifying the problem type. "" is to be understood as "about:blank"
+	Title      string                     // short human-readable summary of the problem type
+	Status     int                        // HTTP status code (as generated by the origin server)
+	Detail     string                     // human-readable explanation specific to this occurrence
+	Instance   string                     // URI reference identifying this specific occurrence
+	Extensions map[string]json.RawMessage // any other members
+}
+
+var _ error = (*ProblemDetails)(nil)
+
+func (p *ProblemDetails) Error() string {
+	switch {
+	case p.Title != "" && p.Detail != "":
+		return p.Title + ": " + p.Detail
+	case p.Title != "":
+		return p.Title
+	case p.Detail != "":
+		return p.Detail
+	default:
+		return p.Type
+	}
+}
+
+// decodes an extension member into *ref*. returns false if the member doesn't exist.
+func (p *ProblemDetails) Extension(key string, ref interface{}) (bool, error) {
+	raw, found := p.Extensions[key]
+	if !found {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(raw, ref)
+}
+
+func (p *ProblemDetails) UnmarshalJSON(data []byte) error {
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	*p = ProblemDetails{}
+
+	for key, dest := range map[string]interface{}{
+		"type":     &p.Type,
+		"title":    &p.Title,
+		"status":   &p.Status,
+		"detail":   &p.Detail,
+		"instance": &p.Instance,
+	} {
+		raw, found := members[key]
+		if !found {
+			continue
+		}
+		delete(members, key)
+
+		// RFC says consumers must ignore members whose value types are wrong, so not an error
+		_ = json.Unmarshal(raw, dest)
+	}
+
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+
+	return nil
+}
+
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	members := map[string]interface{}{}
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+
+	set := func(key string, value interface{}, isSet bool) {
+		if isSet {
+			members[key] = value
+		}
+	}
+
+	set("type", p.Type, p.Type != "")
+	set("title", p.Title, p.Title != "")
+	set("status", p.Status, p.Status != 0)
+	set("detail", p.Detail, p.Detail != "")
+	set("instance", p.Instance, p.Instance != "")
+
+	return json.Marshal(members)
+}
+
+// decodes an error response body into ProblemDetails. returns nil (without error) if the body
+// is not of the expected shape (f.ex. wrong content type) to fall back to plain text handling.
+type ProblemDecoder func(contentType string, body []byte) (*ProblemDetails, error)
+
+// decodes "application/problem+json" responses. this is the default.
+func DecodeProblemJSON(contentType string, body []byte) (*ProblemDetails, error) {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != problemJSONContentType {
+		return nil, nil
+	}
+
+	problem := &ProblemDetails{}
+	if err := json.Unmarshal(body, problem); err != nil {
+		return nil, fmt.Errorf("DecodeProblemJSON: %w", err)
+	}
+
+	return problem, nil
+}
+
+// for APIs that don't speak RFC 7807 but have their own JSON error shape. the JSON error body
+// is decoded into T which *toProblem* maps into ProblemDetails. "application/problem+json"
+// responses are still decoded as usual.
+func ErrorsAsJSON[T any](toProblem func(T) ProblemDetails) ConfigPiece {
+	return After(func(conf *Config) {
+		conf.ProblemDecoder = func(contentType string, body []byte) (*ProblemDetails, error) {
+			mediaType, _, _ := mime.ParseMediaType(contentType)
+			switch {
+			case mediaType == problemJSONContentType:
+				return DecodeProblemJSON(contentType, body)
+			case mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json"):
+				var errorBody T
+				if err := json.Unmarshal(body, &errorBody); err != nil {
+					return nil, fmt.Errorf("ErrorsAsJSON: %w", err)
+				}
+
+				problem := toProblem(errorBody)
+				return &problem, nil
+			default:
+				return nil, nil
+			}
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package ezhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestProblemDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{
+			"type": "https://example.com/probs/out-of-credit",
+			"title": "You do not have enough credit.",
+			"detail": "Your current balance is 30, but that costs 50.",
+			"instance": "/account/12345/msgs/abc",
+			"balance": 30
+		}`)
+	}))
+	defer ts.Close()
+
+	_, err := Get(context.Background(), ts.URL)
+	assert.Equal(t, err.Error(), "403 Forbidden; You do not have enough credit.: Your current balance is 30, but that costs 50.")
+	assert.Equal(t, ErrorIs(err, http.StatusForbidden), true)
+
+	var problem *ProblemDetails
+	assert.Equal(t, errors.As(err, &problem), true)
+	assert.Equal(t, problem.Type, "https://example.com/probs/out-of-credit")
+	assert.Equal(t, problem.Instance, "/account/12345/msgs/abc")
+
+	balance := 0
+	found, err2 := problem.Extension("balance", &balance)
+	assert.Ok(t, err2)
+	assert.Equal(t, found, true)
+	assert.Equal(t, balance, 30)
+
+	var statusErr *ResponseStatusError
+	assert.Equal(t, errors.As(err, &statusErr), true)
+	assert.Equal(t, statusErr.Header().Get("Retry-After"), "120")
+}
+
+func TestProblemDetailsNotForPlainErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	_, err := Get(context.Background(), ts.URL)
+	assert.Equal(t, err.Error(), "429 Too Many Requests; slow down\n")
+
+	var problem *ProblemDetails
+	assert.Equal(t, errors.As(err, &problem), false)
+
+	var statusErr *ResponseStatusError
+	assert.Equal(t, errors.As(err, &statusErr), true)
+	assert.Equal(t, statusErr.Header().Get("X-RateLimit-Remaining"), "0")
+}
+
+func TestErrorsAsJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found", "documentation_url": "https://docs.example.com/"}`)
+	}))
+	defer ts.Close()
+
+	type apiError struct {
+		Message          string `json:"message"`
+		DocumentationURL string `json:"documentation_url"`
+	}
+
+	_, err := Get(context.Background(), ts.URL, ErrorsAsJSON(func(e apiError) ProblemDetails {
+		return ProblemDetails{Title: e.Message, Type: e.DocumentationURL}
+	}))
+	assert.Equal(t, err.Error(), "404 Not Found; Not Found")
+
+	var problem *ProblemDetails
+	assert.Equal(t, errors.As(err, &problem), true)
+	assert.Equal(t, problem.Type, "https://docs.example.com/")
+}
+
+func TestProblemDetailsMarshalJSON(t *testing.T) {
+	assert.EqualJSON(t, ProblemDetails{
+		Title:      "Not Found",
+		Status:     404,
+		Extensions: map[string]json.RawMessage{"id": json.RawMessage(`"123"`)},
+	}, `{
+  "id": "123",
+  "status": 404,
+  "title": "Not Found"
+}`)
+}
@@ -0,0 +1,260 @@
+package ezhttp
+
+// Client-side per-host rate limiting and concurrency caps, so batch jobs with many workers don't
+// get us banned by third-party APIs. Share one RateLimiter across all workers:
+//
+//	limiter := ezhttp.NewRateLimiter(ezhttp.HostLimits{RequestsPerSecond: 5, MaxInFlight: 2}, nil)
+//	_, err := ezhttp.Get(ctx, url, ezhttp.Client(limiter.Client()))
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/function61/gokit/builtin"
+)
+
+type HostLimits struct {
+	RequestsPerSecond float64 // 0 = unlimited
+	Burst             int     // how many requests can be made at once after idle period. defaults to 1
+	MaxInFlight       int     // 0 = unlimited. request is in flight until its response body is closed
+}
+
+type HostStats struct {
+	Requests    int64         // requests that got through the queue
+	InFlight    int           // currently
+	QueuedTotal time.Duration // sum of time spent queueing
+	QueuedMax   time.Duration // longest time a single request spent queueing
+}
+
+// safe for concurrent use
+type RateLimiter struct {
+	inner         http.RoundTripper
+	defaultLimits HostLimits
+	hostLimits    map[string]HostLimits
+	hosts         map[string]*hostLimiter
+	mu            sync.Mutex
+	now           func() time.Time
+}
+
+var _ http.RoundTripper = (*RateLimiter)(nil)
+
+// *defaultLimits* apply to each host separately. pass nil *inner* to use http.DefaultTransport
+func NewRateLimiter(defaultLimits HostLimits, inner http.RoundTripper) *RateLimiter {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+
+	return &RateLimiter{
+		inner:         inner,
+		defaultLimits: defaultLimits,
+		hostLimits:    map[string]HostLimits{},
+		hosts:         map[string]*hostLimiter{},
+		now:           time.Now,
+	}
+}
+
+// overrides default limits for *host* (as in `URL.Host`, i.e. including port if it's in the URL).
+// must be called before requests to the host are made.
+func (r *RateLimiter) SetHostLimits(host string, limits HostLimits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hostLimits[host] = limits
+}
+
+// use with Client() ConfigPiece
+func (r *RateLimiter) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// stats keyed by host
+func (r *RateLimiter) Stats() map[string]HostStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := map[string]HostStats{}
+	for host, limiter := range r.hosts {
+		limiter.mu.Lock()
+		stats[host] = limiter.stats
+		limiter.mu.Unlock()
+	}
+
+	return stats
+}
+
+func (r *RateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := r.limiterFor(req.URL.Host)
+
+	queueStarted := r.now()
+
+	release, err := limiter.acquire(req.Context(), r.now)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter.recordDequeued(r.now().Sub(queueStarted))
+
+	resp, err := r.inner.RoundTrip(req)
+	if err != nil {
+		release()
+		return resp, err
+	}
+
+	// in-flight until the caller is done with the body
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+func (r *RateLimiter) limiterFor(host string) *hostLimiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limiter, found := r.hosts[host]
+	if !found {
+		limits, hasOverride := r.hostLimits[host]
+		if !hasOverride {
+			limits = r.defaultLimits
+		}
+
+		limiter = newHostLimiter(limits, r.now())
+		r.hosts[host] = limiter
+	}
+
+	return limiter
+}
+
+// token bucket for rate + semaphore for in-flight
+type hostLimiter struct {
+	limits     HostLimits
+	inFlight   chan Void // nil if unlimited
+	tokens     float64
+	lastRefill time.Time
+	stats      HostStats
+	mu         sync.Mutex
+}
+
+func newHostLimiter(limits HostLimits, now time.Time) *hostLimiter {
+	if limits.Burst < 1 {
+		limits.Burst = 1
+	}
+
+	inFlight := chan Void(nil)
+	if limits.MaxInFlight > 0 {
+		inFlight = make(chan Void, limits.MaxInFlight)
+	}
+
+	return &hostLimiter{
+		limits:     limits,
+		inFlight:   inFlight,
+		tokens:     float64(limits.Burst),
+		lastRefill: now,
+	}
+}
+
+// waits (respecting context cancellation) until the request is allowed. returns func to call when the request is done.
+func (h *hostLimiter) acquire(ctx context.Context, now func() time.Time) (func(), error) {
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- Void{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	freeSlot := func() {
+		if h.inFlight != nil {
+			<-h.inFlight
+		}
+	}
+
+	if wait := h.reserve(now()); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			h.unreserve()
+			freeSlot()
+			return nil, ctx.Err()
+		}
+	}
+
+	// only now, so that requests waiting for a rate token aren't reported as in flight
+	h.mu.Lock()
+	h.stats.InFlight++
+	h.mu.Unlock()
+
+	releaseOnce := sync.Once{}
+	return func() {
+		releaseOnce.Do(func() {
+			h.mu.Lock()
+			h.stats.InFlight--
+			h.mu.Unlock()
+
+			freeSlot()
+		})
+	}, nil
+}
+
+// takes a token (possibly going into debt). returns how long caller has to wait for the debt to be paid
+func (h *hostLimiter) reserve(now time.Time) time.Duration {
+	if h.limits.RequestsPerSecond <= 0 {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tokens += now.Sub(h.lastRefill).Seconds() * h.limits.RequestsPerSecond
+	if h.tokens > float64(h.limits.Burst) {
+		h.tokens = float64(h.limits.Burst)
+	}
+	h.lastRefill = now
+
+	h.tokens--
+
+	if h.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-h.tokens / h.limits.RequestsPerSecond * float64(time.Second))
+}
+
+// gives back token taken by reserve() if the caller gave up waiting
+func (h *hostLimiter) unreserve() {
+	if h.limits.RequestsPerSecond <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tokens++
+}
+
+func (h *hostLimiter) recordDequeued(queued time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stats.Requests++
+	h.stats.QueuedTotal += queued
+	if queued > h.stats.QueuedMax {
+		h.stats.QueuedMax = queued
+	}
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	defer r.release()
+
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,136 @@
+package ezhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestRateLimiterMaxInFlight(t *testing.T) {
+	inFlight := int64(0)
+	maxInFlight := int64(0)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+
+		for {
+			observed := atomic.LoadInt64(&maxInFlight)
+			if current <= observed || atomic.CompareAndSwapInt64(&maxInFlight, observed, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	limiter := NewRateLimiter(HostLimits{MaxInFlight: 2}, nil)
+
+	errs := make([]error, 6) // asserted in the test goroutine
+
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			resp, err := Get(context.Background(), ts.URL, Client(limiter.Client()))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.Ok(t, err)
+	}
+
+	assert.Equal(t, atomic.LoadInt64(&maxInFlight), int64(2))
+
+	stats := limiter.Stats()[strings.TrimPrefix(ts.URL, "http://")]
+	assert.Equal(t, stats.Requests, int64(6))
+	assert.Equal(t, stats.InFlight, 0)
+	assert.Equal(t, stats.QueuedMax > 10*time.Millisecond, true)
+}
+
+func TestRateLimiterRequestsPerSecond(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	limiter := NewRateLimiter(HostLimits{RequestsPerSecond: 20}, nil)
+
+	started := time.Now()
+
+	for i := 0; i < 5; i++ {
+		resp, err := Get(context.Background(), ts.URL, Client(limiter.Client()))
+		assert.Ok(t, err)
+		resp.Body.Close()
+	}
+
+	// first one immediately, then 4 * 50ms
+	assert.Equal(t, time.Since(started) >= 190*time.Millisecond, true)
+}
+
+func TestRateLimiterQueueingRespectsContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	limiter := NewRateLimiter(HostLimits{}, nil)
+	limiter.SetHostLimits(strings.TrimPrefix(ts.URL, "http://"), HostLimits{MaxInFlight: 1})
+
+	hogger, err := Get(context.Background(), ts.URL, Client(limiter.Client()))
+	assert.Ok(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = Get(ctx, ts.URL, Client(limiter.Client()))
+	assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true)
+
+	hogger.Body.Close() // releases the slot
+
+	resp, err := Get(context.Background(), ts.URL, Client(limiter.Client()))
+	assert.Ok(t, err)
+	resp.Body.Close()
+}
+
+func TestRateLimiterQueuedIsNotInFlight(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	limiter := NewRateLimiter(HostLimits{RequestsPerSecond: 0.1}, nil)
+
+	hogger, err := Get(context.Background(), ts.URL, Client(limiter.Client()))
+	assert.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queuedDone := make(chan error, 1)
+	go func() {
+		_, err := Get(ctx, ts.URL, Client(limiter.Client()))
+		queuedDone <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond) // let it start waiting for a rate token (10 s)
+	assert.Equal(t, limiter.Stats()[host].InFlight, 1)
+
+	cancel()
+	assert.Equal(t, errors.Is(<-queuedDone, context.Canceled), true)
+	assert.Equal(t, limiter.Stats()[host].InFlight, 1)
+
+	hogger.Body.Close()
+	assert.Equal(t, limiter.Stats()[host].InFlight, 0)
+}
@@ -0,0 +1,393 @@
+package ezhttp
+
+// Record/replay transport for deterministic tests. Record real exchanges once against the real
+// service into a fixture file (HAR-like JSON), commit the fixture and later replay it offline.
+//
+// Usage:
+//
+//	recorder := ezhttp.NewRecorder("testdata/api.har.json", nil)
+//	_, err := ezhttp.Get(ctx, url, ezhttp.Client(recorder.Client()))
+//	err = recorder.Save()
+//
+//	replayer, err := ezhttp.NewReplayer("testdata/api.har.json", ezhttp.MatchBody())
+//	_, err := ezhttp.Get(ctx, url, ezhttp.Client(replayer.Client()))
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/function61/gokit/encoding/jsonfile"
+)
+
+// values of these headers are replaced with RedactedHeaderValue in recorded fixtures, so that
+// credentials don't end up in the repo. add more with Recorder.RedactHeaders().
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Amz-Security-Token",
+	"X-Api-Key",
+}
+
+const RedactedHeaderValue = "REDACTED"
+
+// returned (wrapped) from the replaying transport when a request has no unused recorded counterpart
+var ErrReplayNoMatch = errors.New("ezhttp: replay: no matching recorded request")
+
+// format loosely follows HAR (HTTP Archive) so the fixtures are somewhat familiar and readable
+type Fixture struct {
+	Log FixtureLog `json:"log"`
+}
+
+type FixtureLog struct {
+	Entries []FixtureEntry `json:"entries"`
+}
+
+type FixtureEntry struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+type FixtureRequest struct {
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Headers  []FixtureHeader `json:"headers"`
+	PostData *FixtureContent `json:"postData,omitempty"`
+}
+
+type FixtureResponse struct {
+	Status     int             `json:"status"`
+	StatusText string          `json:"statusText"`
+	Headers    []FixtureHeader `json:"headers"`
+	Content    FixtureContent  `json:"content"`
+}
+
+type FixtureHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type FixtureContent struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // "base64" if content was not valid UTF-8
+}
+
+// decides if an incoming request matches a recorded one. method and URL are always matched
+// by the replayer, the matchers can add further restrictions.
+type RequestMatcher func(recorded FixtureRequest, actual *http.Request, actualBody []byte) bool
+
+// the request bodies must be byte-for-byte equal
+func MatchBody() RequestMatcher {
+	return func(recorded FixtureRequest, _ *http.Request, actualBody []byte) bool {
+		recordedBody, err := recorded.PostData.bytes()
+		if err != nil {
+			return false
+		}
+
+		return bytes.Equal(recordedBody, actualBody)
+	}
+}
+
+// values of the given headers must be equal (a header missing from both sides is considered equal).
+// NOTE: redacted headers were recorded as RedactedHeaderValue, so they can't be matched.
+func MatchHeaders(keys ...string) RequestMatcher {
+	return func(recorded FixtureRequest, actual *http.Request, _ []byte) bool {
+		recordedHeaders := recorded.header()
+
+		for _, key := range keys {
+			if strings.Join(recordedHeaders.Values(key), ",") != strings.Join(actual.Header.Values(key), ",") {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// records the exchanges passing through it. call Save() after you're done.
+type Recorder struct {
+	fixturePath string
+	upstream    http.RoundTripper
+	redacted    []string
+	entries     []FixtureEntry
+	entriesMu   sync.Mutex
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+// pass nil upstream to use http.DefaultTransport
+func NewRecorder(fixturePath string, upstream http.RoundTripper) *Recorder {
+	if upstream == nil {
+		upstream = http.DefaultTransport
+	}
+
+	return &Recorder{
+		fixturePath: fixturePath,
+		upstream:    upstream,
+		redacted:    append([]string{}, DefaultRedactedHeaders...),
+		entries:     []FixtureEntry{},
+	}
+}
+
+// redacts also these headers (in addition to DefaultRedactedHeaders) of requests and responses
+func (r *Recorder) RedactHeaders(keys ...string) *Recorder {
+	r.redacted = append(r.redacted, keys...)
+	return r
+}
+
+// use with Client() ConfigPiece
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // RoundTripper must not modify the caller's request (we replace body)
+
+	reqBody, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ezhttp: record: %w", err)
+	}
+
+	resp, err := r.upstream.RoundTrip(req)
+	if err != nil {
+		return resp, err // transport-level errors are not recorded
+	}
+
+	respBody, err := drainBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ezhttp: record: %w", err)
+	}
+
+	entry := FixtureEntry{
+		Request: FixtureRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: fixtureHeaders(req.Header, r.redacted),
+		},
+		Response: FixtureResponse{
+			Status:     resp.StatusCode,
+			StatusText: http.StatusText(resp.StatusCode),
+			Headers:    fixtureHeaders(resp.Header, r.redacted),
+			Content:    fixtureContent(resp.Header.Get("Content-Type"), respBody),
+		},
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		postData := fixtureContent(req.Header.Get("Content-Type"), reqBody)
+		entry.Request.PostData = &postData
+	}
+
+	r.entriesMu.Lock()
+	defer r.entriesMu.Unlock()
+
+	r.entries = append(r.entries, entry)
+
+	return resp, nil
+}
+
+// writes (atomically) the recorded exchanges to the fixture file
+func (r *Recorder) Save() error {
+	r.entriesMu.Lock()
+	defer r.entriesMu.Unlock()
+
+	return jsonfile.Write(r.fixturePath, Fixture{
+		Log: FixtureLog{Entries: r.entries},
+	})
+}
+
+// replays exchanges from a fixture without touching the network. each recorded entry is
+// replayed at most once, in recording order, so repeated identical requests can get
+// different responses.
+type Replayer struct {
+	entries   []FixtureEntry
+	used      []bool
+	matchers  []RequestMatcher
+	entriesMu sync.Mutex
+}
+
+var _ http.RoundTripper = (*Replayer)(nil)
+
+func NewReplayer(fixturePath string, matchers ...RequestMatcher) (*Replayer, error) {
+	fixture := Fixture{}
+	if err := jsonfile.ReadDisallowUnknownFields(fixturePath, &fixture); err != nil {
+		return nil, fmt.Errorf("ezhttp: NewReplayer: %w", err)
+	}
+
+	return &Replayer{
+		entries:  fixture.Log.Entries,
+		used:     make([]bool, len(fixture.Log.Entries)),
+		matchers: matchers,
+	}, nil
+}
+
+// use with Client() ConfigPiece
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// how many recorded entries have not been replayed yet
+func (r *Replayer) Remaining() int {
+	r.entriesMu.Lock()
+	defer r.entriesMu.Unlock()
+
+	remaining := 0
+	for _, used := range r.used {
+		if !used {
+			remaining++
+		}
+	}
+
+	return remaining
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ezhttp: replay: %w", err)
+	}
+
+	r.entriesMu.Lock()
+	defer r.entriesMu.Unlock()
+
+	for idx, entry := range r.entries {
+		if r.used[idx] || !r.matches(entry.Request, req, reqBody) {
+			continue
+		}
+
+		respBody, err := entry.Response.Content.bytes()
+		if err != nil {
+			return nil, fmt.Errorf("ezhttp: replay: entry %d: %w", idx, err)
+		}
+
+		r.used[idx] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+			StatusCode:    entry.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        entry.Response.header(),
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrReplayNoMatch, req.Method, req.URL.String())
+}
+
+func (r *Replayer) matches(recorded FixtureRequest, actual *http.Request, actualBody []byte) bool {
+	if recorded.Method != actual.Method || recorded.URL != actual.URL.String() {
+		return false
+	}
+
+	for _, matcher := range r.matchers {
+		if !matcher(recorded, actual, actualBody) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reads the body fully and replaces it with an in-memory copy so it can still be consumed
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	content, err := io.ReadAll(*body)
+	closeErr := (*body).Close() // also on read errors, so the connection isn't leaked
+	if err != nil {
+		return nil, err
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	*body = io.NopCloser(bytes.NewReader(content))
+
+	return content, nil
+}
+
+func fixtureHeaders(header http.Header, redacted []string) []FixtureHeader {
+	keys := []string{}
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // for stable fixture diffs
+
+	headers := []FixtureHeader{}
+	for _, key := range keys {
+		redact := false
+		for _, redactedKey := range redacted {
+			if strings.EqualFold(key, redactedKey) {
+				redact = true
+			}
+		}
+
+		for _, value := range header[key] {
+			if redact {
+				value = RedactedHeaderValue
+			}
+
+			headers = append(headers, FixtureHeader{Name: key, Value: value})
+		}
+	}
+
+	return headers
+}
+
+func fixtureContent(mimeType string, content []byte) FixtureContent {
+	if utf8.Valid(content) {
+		return FixtureContent{MimeType: mimeType, Text: string(content)}
+	} else {
+		return FixtureContent{
+			MimeType: mimeType,
+			Text:     base64.StdEncoding.EncodeToString(content),
+			Encoding: "base64",
+		}
+	}
+}
+
+func (f FixtureRequest) header() http.Header {
+	return httpHeader(f.Headers)
+}
+
+func (f FixtureResponse) header() http.Header {
+	return httpHeader(f.Headers)
+}
+
+func httpHeader(headers []FixtureHeader) http.Header {
+	header := http.Header{}
+	for _, h := range headers {
+		header.Add(h.Name, h.Value)
+	}
+
+	return header
+}
+
+// nil-safe
+func (f *FixtureContent) bytes() ([]byte, error) {
+	switch {
+	case f == nil:
+		return nil, nil
+	case f.Encoding == "base64":
+		return base64.StdEncoding.DecodeString(f.Text)
+	case f.Encoding == "":
+		return []byte(f.Text), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", f.Encoding)
+	}
+}
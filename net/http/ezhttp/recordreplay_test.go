@@ -0,0 +1,142 @@
+package ezhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+
+	requestCount := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"Hello": "%s %s #%d"}`, r.Method, body, requestCount)
+	}))
+
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder := NewRecorder(fixturePath, nil)
+
+	for _, greeting := range []string{"hi", "hi", "bye"} {
+		_, err := Post(ctx, ts.URL+"/greet", SendBody(strings.NewReader(greeting), "text/plain"), Client(recorder.Client()))
+		assert.Ok(t, err)
+	}
+
+	assert.Ok(t, recorder.Save())
+
+	ts.Close() // make sure the network is not touched anymore
+	url := ts.URL
+
+	replayer, err := NewReplayer(fixturePath, MatchBody())
+	assert.Ok(t, err)
+
+	replay := func(greeting string) string {
+		res := ExampleJsonPayload{}
+		_, err := Post(ctx, url+"/greet", SendBody(strings.NewReader(greeting), "text/plain"), Client(replayer.Client()), RespondsJSONDisallowUnknownFields(&res))
+		assert.Ok(t, err)
+		return res.Hello
+	}
+
+	// replayed out of recording order, which is fine because the body matcher picks the right one
+	assert.Equal(t, replay("bye"), "POST bye #3")
+	assert.Equal(t, replay("hi"), "POST hi #1")
+	assert.Equal(t, replay("hi"), "POST hi #2")
+	assert.Equal(t, replayer.Remaining(), 0)
+
+	// recorded entries were used up
+	_, err = Post(ctx, url+"/greet", SendBody(strings.NewReader("hi"), "text/plain"), Client(replayer.Client()))
+	assert.Equal(t, errors.Is(err, ErrReplayNoMatch), true)
+	assert.Matches(t, err.Error(), "no matching recorded request: POST http://.+/greet")
+}
+
+func TestReplayMatchHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "lang=%s", r.Header.Get("Accept-Language"))
+	}))
+	defer ts.Close()
+
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder := NewRecorder(fixturePath, nil)
+	_, err := Get(context.Background(), ts.URL, Header("Accept-Language", "fi"), Client(recorder.Client()))
+	assert.Ok(t, err)
+	assert.Ok(t, recorder.Save())
+
+	replayer, err := NewReplayer(fixturePath, MatchHeaders("Accept-Language"))
+	assert.Ok(t, err)
+
+	_, err = Get(context.Background(), ts.URL, Header("Accept-Language", "en"), Client(replayer.Client()))
+	assert.Equal(t, errors.Is(err, ErrReplayNoMatch), true)
+
+	resp, err := Get(context.Background(), ts.URL, Header("Accept-Language", "fi"), Client(replayer.Client()))
+	assert.Ok(t, err)
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, string(body), "lang=fi")
+}
+
+func TestRecorderBodies(t *testing.T) {
+	reqBody := &trackingBody{Reader: strings.NewReader("hello")}
+	respBody := &trackingBody{Reader: iotest.ErrReader(errors.New("connection reset"))}
+
+	recorder := NewRecorder(filepath.Join(t.TempDir(), "fixture.json"), roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: respBody}, nil
+	}))
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/", reqBody)
+	assert.Ok(t, err)
+
+	_, err = recorder.RoundTrip(req)
+	assert.Equal(t, err.Error(), "ezhttp: record: connection reset")
+
+	// caller's request is not modified, but its body is closed (like the `http.RoundTripper` contract says)
+	assert.Equal(t, req.Body == io.ReadCloser(reqBody), true)
+	assert.Equal(t, reqBody.closed, true)
+	assert.Equal(t, respBody.closed, true)
+}
+
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRecorderRedactsHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secretsession"})
+		fmt.Fprintln(w, "ok")
+	}))
+	defer ts.Close()
+
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder := NewRecorder(fixturePath, nil).RedactHeaders("X-Custom-Secret")
+	_, err := Get(context.Background(), ts.URL, AuthBearer("secrettoken"), Header("X-Custom-Secret", "secretvalue"), Header("Accept-Language", "fi"), Client(recorder.Client()))
+	assert.Ok(t, err)
+	assert.Ok(t, recorder.Save())
+
+	fixture, err := os.ReadFile(fixturePath)
+	assert.Ok(t, err)
+
+	assert.Equal(t, strings.Contains(string(fixture), "secret"), false)
+	assert.Equal(t, strings.Count(string(fixture), `"value": "REDACTED"`), 3)
+	assert.Equal(t, strings.Contains(string(fixture), `"value": "fi"`), true)
+}
@@ -0,0 +1,47 @@
+package ezhttp
+
+// Generic helpers for the most common case of JSON APIs: decode the response into a value and
+// return it, instead of having to declare the output variable before the call.
+
+import (
+	"context"
+	"net/http"
+)
+
+// forces the caller to think whether to be forward compatible (= server is allowed to add new
+// fields to JSON structure). see RespondsJSONAllowUnknownFields() and RespondsJSONDisallowUnknownFields().
+type UnknownFields struct {
+	allow bool
+}
+
+var (
+	AllowUnknownFields    = UnknownFields{allow: true}
+	DisallowUnknownFields = UnknownFields{allow: false}
+)
+
+func GetJSON[Resp any](ctx context.Context, url string, unknownFields UnknownFields, confPieces ...ConfigPiece) (Resp, error) {
+	return doJSON[Resp](ctx, http.MethodGet, url, unknownFields, confPieces)
+}
+
+func PostJSON[Req any, Resp any](ctx context.Context, url string, body Req, unknownFields UnknownFields, confPieces ...ConfigPiece) (Resp, error) {
+	return doJSON[Resp](ctx, http.MethodPost, url, unknownFields, append([]ConfigPiece{SendJSON(body)}, confPieces...))
+}
+
+func PutJSON[Req any, Resp any](ctx context.Context, url string, body Req, unknownFields UnknownFields, confPieces ...ConfigPiece) (Resp, error) {
+	return doJSON[Resp](ctx, http.MethodPut, url, unknownFields, append([]ConfigPiece{SendJSON(body)}, confPieces...))
+}
+
+func PatchJSON[Req any, Resp any](ctx context.Context, url string, body Req, unknownFields UnknownFields, confPieces ...ConfigPiece) (Resp, error) {
+	return doJSON[Resp](ctx, http.MethodPatch, url, unknownFields, append([]ConfigPiece{SendJSON(body)}, confPieces...))
+}
+
+func doJSON[Resp any](ctx context.Context, method string, url string, unknownFields UnknownFields, confPieces []ConfigPiece) (Resp, error) {
+	var output Resp
+	// the JSON decoding happens (and body gets closed) inside Send()
+	if _, err := Do(ctx, method, url, append(confPieces, respondsJSON(&output, unknownFields.allow))...); err != nil {
+		var zero Resp // don't return partially decoded value
+		return zero, err
+	}
+
+	return output, nil
+}
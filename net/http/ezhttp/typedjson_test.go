@@ -0,0 +1,61 @@
+package ezhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestGetJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"Hello": "World", "got": "more than you asked for"}`)
+	}))
+	defer ts.Close()
+
+	res, err := GetJSON[ExampleJsonPayload](context.Background(), ts.URL, AllowUnknownFields)
+	assert.Ok(t, err)
+	assert.Equal(t, res.Hello, "World")
+
+	_, err = GetJSON[ExampleJsonPayload](context.Background(), ts.URL, DisallowUnknownFields)
+	assert.Equal(t, err.Error(), `json: unknown field "got"`)
+}
+
+func TestPostAndPatchJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := ExampleJsonPayload{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			panic(err)
+		}
+
+		fmt.Fprintf(w, `{"Hello": "%s %s"}`, r.Method, req.Hello)
+	}))
+	defer ts.Close()
+
+	res, err := PostJSON[ExampleJsonPayload, ExampleJsonPayload](context.Background(), ts.URL, ExampleJsonPayload{Hello: "world"}, DisallowUnknownFields)
+	assert.Ok(t, err)
+	assert.Equal(t, res.Hello, "POST world")
+
+	res, err = PatchJSON[ExampleJsonPayload, ExampleJsonPayload](context.Background(), ts.URL, ExampleJsonPayload{Hello: "world"}, DisallowUnknownFields)
+	assert.Ok(t, err)
+	assert.Equal(t, res.Hello, "PATCH world")
+}
+
+func TestOptionsAndDo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	}))
+	defer ts.Close()
+
+	resp, err := Options(context.Background(), ts.URL)
+	assert.Ok(t, err)
+	assert.Equal(t, resp.Header.Get("X-Method"), "OPTIONS")
+
+	resp, err = Do(context.Background(), "PROPFIND", ts.URL)
+	assert.Ok(t, err)
+	assert.Equal(t, resp.Header.Get("X-Method"), "PROPFIND")
+}
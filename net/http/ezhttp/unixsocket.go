@@ -0,0 +1,106 @@
+package ezhttp
+
+// Talking HTTP over Unix sockets (Docker, systemd-like daemons, our own `netutil.ListenUnix*()` servers).
+//
+// Either use the `UnixSocket()` ConfigPiece with a regular URL (whose host is ignored), or
+// use a URL like "unix:///var/run/docker.sock:/v1.41/containers/json" (socket path, colon, HTTP path).
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const unixSocketURLPrefix = "unix://"
+
+var unixSocketTransports sync.Map // socket path => *http.Transport. cached so connections get reused
+
+// sends the request over the Unix socket at *sockPath*. works also with a custom Client(), as long
+// as its transport is a `*http.Transport` (its dialer is replaced).
+func UnixSocket(sockPath string) ConfigPiece {
+	return After(func(conf *Config) {
+		conf.UnixSocketPath = sockPath
+	})
+}
+
+// connects with *dial* instead of the default dialer (f.ex. SSH tunnels, in-memory listeners).
+// address is "host:port" of the request URL. NOTE: builds a new transport each time, so for connection
+// reuse build the client once yourself and use Client().
+func CustomDialer(dial func(ctx context.Context, network string, address string) (net.Conn, error)) ConfigPiece {
+	return After(func(conf *Config) {
+		conf.Client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: dial,
+			},
+		}
+	})
+}
+
+// HTTP client that connects to *sockPath* regardless of the host in the request URL.
+// a new client each time (so you can set f.ex. `Timeout`), but they share connections.
+func UnixSocketClient(sockPath string) *http.Client {
+	return &http.Client{Transport: unixSocketTransport(sockPath)}
+}
+
+func unixSocketTransport(sockPath string) *http.Transport {
+	if transport, found := unixSocketTransports.Load(sockPath); found {
+		return transport.(*http.Transport)
+	}
+
+	transport, _ := unixSocketTransports.LoadOrStore(sockPath, &http.Transport{
+		DialContext: unixSocketDialer(sockPath),
+	})
+
+	return transport.(*http.Transport)
+}
+
+func unixSocketDialer(sockPath string) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		dialer := net.Dialer{}
+		return dialer.DialContext(ctx, "unix", sockPath)
+	}
+}
+
+// *client* (whatever Client() ended up being used) but connecting to *sockPath*. fails instead of
+// silently connecting over TCP if the client's transport's dialer can't be replaced.
+func clientForUnixSocket(client *http.Client, sockPath string) (*http.Client, error) {
+	var transport *http.Transport
+
+	switch existing := client.Transport.(type) {
+	case nil:
+		transport = unixSocketTransport(sockPath)
+	case *http.Transport:
+		switch {
+		case existing == http.DefaultTransport:
+			transport = unixSocketTransport(sockPath)
+		case existing == unixSocketTransport(sockPath):
+			transport = existing
+		default: // caller's own settings (TLS etc.). NOTE: new transport for each request, so no connection reuse
+			transport = existing.Clone()
+			transport.DialContext = unixSocketDialer(sockPath)
+		}
+	default:
+		return nil, fmt.Errorf("ezhttp: Unix socket %s requires client with *http.Transport, got %T", sockPath, existing)
+	}
+
+	withUnixSocket := *client // shallow copy so we don't mutate a possibly shared client
+	withUnixSocket.Transport = transport
+
+	return &withUnixSocket, nil
+}
+
+// "unix:///run/app.sock:/api/items?id=1" => ("/run/app.sock", "http://localhost/api/items?id=1").
+// socket paths containing a colon are not supported.
+func parseUnixSocketURL(unixURL string) (string, string, error) {
+	sockPath, httpPath, found := strings.Cut(strings.TrimPrefix(unixURL, unixSocketURLPrefix), ":")
+	if !found || sockPath == "" || !strings.HasPrefix(httpPath, "/") {
+		return "", "", errors.New("ezhttp: malformed Unix socket URL (expecting unix:///path/to.sock:/http/path): " + unixURL)
+	}
+
+	// host is required by HTTP/1.1 but meaningless for Unix sockets
+	return sockPath, "http://localhost" + httpPath, nil
+}
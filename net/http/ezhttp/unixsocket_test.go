@@ -0,0 +1,62 @@
+package ezhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/function61/gokit/net/netutil"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestUnixSocket(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "app.sock")
+
+	listening := make(chan net.Listener, 1)
+	go func() {
+		_ = netutil.ListenUnixAllowOwner(sockPath, func(listener net.Listener) error {
+			listening <- listener
+
+			return http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+			}))
+		})
+	}()
+	defer func() { (<-listening).Close() }()
+
+	listener := <-listening
+	listening <- listener // for the deferred close
+
+	get := func(url string, confPieces ...ConfigPiece) string {
+		resp, err := Get(context.Background(), url, confPieces...)
+		assert.Ok(t, err)
+
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	assert.Equal(t, get("unix://"+sockPath+":/v1.41/containers/json?all=1"), "GET /v1.41/containers/json?all=1")
+	assert.Equal(t, get("http://ignored/api/items", UnixSocket(sockPath)), "GET /api/items")
+	assert.Equal(t, get("http://ignored/api/custom", CustomDialer(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", sockPath)
+	})), "GET /api/custom")
+
+	// socket applies also to a client given later
+	assert.Equal(t, get("unix://"+sockPath+":/late-client", Client(http.DefaultClient)), "GET /late-client")
+	assert.Equal(t, get("http://ignored/custom-transport", UnixSocket(sockPath), Client(&http.Client{Transport: &http.Transport{}})), "GET /custom-transport")
+
+	_, err := Get(context.Background(), "unix://"+sockPath+":/x", Client(NewRecorder("unused.json", nil).Client()))
+	assert.Equal(t, err.Error(), "ezhttp: Unix socket "+sockPath+" requires client with *http.Transport, got *ezhttp.Recorder")
+
+	// clients are not shared (so modifying one doesn't affect others), but connections are
+	clientA, clientB := UnixSocketClient(sockPath), UnixSocketClient(sockPath)
+	assert.Equal(t, clientA != clientB, true)
+	assert.Equal(t, clientA.Transport == clientB.Transport, true)
+
+	_, err = Get(context.Background(), "unix://"+sockPath)
+	assert.Equal(t, err.Error(), "ezhttp: malformed Unix socket URL (expecting unix:///path/to.sock:/http/path): unix://"+sockPath)
+}
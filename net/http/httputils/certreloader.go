@@ -0,0 +1,189 @@
+package httputils
+
+// Picks up rotated TLS certificates (from our own CA, ACME tools etc.) without restarting the server:
+//
+//	certs, err := httputils.NewCertificateReloader("/etc/tls/server.crt", "/etc/tls/server.key", logger)
+//	srv.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+//	tasks.Start("certreloader", certs.Run)
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/function61/gokit/crypto/cryptoutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var DefaultCertificateReloadInterval = 1 * time.Minute
+
+// safe for concurrent use
+type CertificateReloader struct {
+	certPath string
+	keyPath  string
+	current  atomic.Pointer[tls.Certificate] // always valid (never nil after construction)
+	logger   *slog.Logger
+	interval time.Duration
+
+	lastSeen   string // modification times and sizes of the files when last (tried) loaded
+	lastSeenMu sync.Mutex
+}
+
+// loads the certificate and key (PEM). fails if they're not valid. cert file can contain intermediates after the leaf.
+// nil *logger* uses `slog.Default()`.
+func NewCertificateReloader(certPath string, keyPath string, logger *slog.Logger) (*CertificateReloader, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	reloader := &CertificateReloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		logger:   logger,
+		interval: DefaultCertificateReloadInterval,
+	}
+
+	if err := reloader.Reload(); err != nil {
+		return nil, fmt.Errorf("NewCertificateReloader: %w", err)
+	}
+
+	return reloader, nil
+}
+
+// for `tls.Config.GetCertificate`
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current.Load(), nil
+}
+
+// expiry of the currently served certificate
+func (c *CertificateReloader) NotAfter() time.Time {
+	return c.current.Load().Leaf.NotAfter
+}
+
+// gauge with the current certificate's expiry as Unix timestamp, so you can alert on rotation not working
+func (c *CertificateReloader) ExpiryMetric() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "tls_certificate_expiry_timestamp_seconds",
+		Help:        "Expiry time of the served TLS certificate",
+		ConstLabels: prometheus.Labels{"path": c.certPath},
+	}, func() float64 {
+		return float64(c.NotAfter().Unix())
+	})
+}
+
+// loads the files now (even if they seem unchanged). on error the previous certificate is kept.
+func (c *CertificateReloader) Reload() error {
+	c.lastSeenMu.Lock()
+	c.lastSeen = c.filesVersion()
+	c.lastSeenMu.Unlock()
+
+	cert, err := loadAndValidateCertificate(c.certPath, c.keyPath, time.Now())
+	if err != nil {
+		return err
+	}
+
+	c.current.Store(cert)
+
+	return nil
+}
+
+// polls the files for changes until *ctx* is canceled. reload errors are logged (and retried
+// only when the files change again), not returned, as the previous certificate can still be served.
+func (c *CertificateReloader) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.lastSeenMu.Lock()
+			changed := c.filesVersion() != c.lastSeen
+			c.lastSeenMu.Unlock()
+
+			if !changed {
+				continue
+			}
+
+			if err := c.Reload(); err != nil {
+				c.logger.Error("certificate reload failed; keeping previous", "err", err, "path", c.certPath)
+			} else {
+				c.logger.Info("certificate reloaded", "path", c.certPath, "not_after", c.NotAfter())
+			}
+		}
+	}
+}
+
+// changes if either of the files changes (also when the files are replaced by renaming or symlink swap)
+func (c *CertificateReloader) filesVersion() string {
+	version := ""
+	for _, path := range []string{c.certPath, c.keyPath} {
+		if info, err := os.Stat(path); err == nil {
+			version += fmt.Sprintf("%d/%d;", info.ModTime().UnixNano(), info.Size())
+		} else {
+			version += "error;"
+		}
+	}
+
+	return version
+}
+
+func loadAndValidateCertificate(certPath string, keyPath string, now time.Time) (*tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// also checks that the key matches the certificate
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := cryptoutil.ParsePemX509Certificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("leaf: %w", err)
+	}
+
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate not valid until %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+
+	// each certificate in the chain must be signed by the next one, so we don't serve a broken chain
+	chain := []*x509.Certificate{leaf}
+	for _, der := range cert.Certificate[1:] {
+		intermediate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("intermediate: %w", err)
+		}
+
+		chain = append(chain, intermediate)
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, errors.New("broken chain: '" + chain[i].Subject.String() + "' not signed by '" + chain[i+1].Subject.String() + "'")
+		}
+	}
+
+	cert.Leaf = leaf // saves parsing it for each handshake
+
+	return &cert, nil
+}
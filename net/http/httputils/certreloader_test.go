@@ -0,0 +1,114 @@
+package httputils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+
+	expiry1 := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	expiry2 := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+
+	ca, caKey, caPEM, _ := makeTestCert(t, "Test CA", expiry2, nil, nil)
+	_, _, leaf1PEM, leaf1KeyPEM := makeTestCert(t, "server v1", expiry1, ca, caKey)
+	_, _, leaf2PEM, leaf2KeyPEM := makeTestCert(t, "server v2", expiry2, ca, caKey)
+	_, _, otherCAPEM, _ := makeTestCert(t, "Other CA", expiry2, nil, nil)
+
+	writeFiles := func(certPEM []byte, keyPEM []byte) {
+		assert.Ok(t, os.WriteFile(certPath, certPEM, 0600))
+		assert.Ok(t, os.WriteFile(keyPath, keyPEM, 0600))
+	}
+
+	servedSubject := func(reloader *CertificateReloader) string {
+		cert, err := reloader.GetCertificate(nil)
+		assert.Ok(t, err)
+		return cert.Leaf.Subject.CommonName
+	}
+
+	writeFiles(append(leaf1PEM, caPEM...), leaf1KeyPEM)
+
+	reloader, err := NewCertificateReloader(certPath, keyPath, nil) // nil = default logger
+	assert.Ok(t, err)
+	assert.Equal(t, servedSubject(reloader), "server v1")
+	assert.Equal(t, testutil.ToFloat64(reloader.ExpiryMetric()), float64(expiry1.Unix()))
+
+	// invalid updates keep the old certificate
+	writeFiles(leaf2PEM, leaf1KeyPEM)
+	assert.Equal(t, reloader.Reload().Error(), "tls: private key does not match public key")
+
+	writeFiles(append(leaf2PEM, otherCAPEM...), leaf2KeyPEM)
+	assert.Equal(t, reloader.Reload().Error(), "broken chain: 'CN=server v2' not signed by 'CN=Other CA'")
+
+	writeFiles([]byte("garbage"), leaf2KeyPEM)
+	assert.Matches(t, reloader.Reload().Error(), "^tls: failed to find any PEM data in certificate input")
+
+	assert.Equal(t, servedSubject(reloader), "server v1")
+
+	// valid update gets picked up by the poller
+	reloader.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = reloader.Run(ctx) }()
+
+	writeFiles(append(leaf2PEM, caPEM...), leaf2KeyPEM)
+	for i := 0; i < 100 && servedSubject(reloader) == "server v1"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, servedSubject(reloader), "server v2")
+	assert.Equal(t, reloader.NotAfter().Equal(expiry2), true)
+}
+
+func TestNewCertificateReloaderInvalid(t *testing.T) {
+	_, err := NewCertificateReloader("/notfound.crt", "/notfound.key", slog.Default())
+	assert.Equal(t, err.Error(), "NewCertificateReloader: open /notfound.crt: no such file or directory")
+}
+
+// parent nil => self-signed CA
+func makeTestCert(t *testing.T, commonName string, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Ok(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"localhost"},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Ok(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Ok(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Ok(t, err)
+
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
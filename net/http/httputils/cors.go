@@ -0,0 +1,185 @@
+package httputils
+
+// Cross-Origin Resource Sharing, for APIs used by browser apps on other origins:
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSPolicy struct {
+	// exact ("https://app.example.com"), wildcard subdomain ("https://*.example.com") or "*" for any.
+	// "*" can't be used with AllowCredentials, as it would let any site make credentialed requests.
+	AllowedOrigins []string
+	// for more complex cases. checked if none of the AllowedOrigins matched
+	AllowOrigin func(origin string) bool
+	// defaults to GET, HEAD and POST. "*" allows any
+	AllowedMethods []string
+	// request headers the browser may send (besides the CORS-safelisted ones). "*" allows any
+	AllowedHeaders []string
+	// response headers the browser lets the app read (besides the CORS-safelisted ones)
+	ExposedHeaders []string
+	// cookies, HTTP auth, client certs
+	AllowCredentials bool
+	// how long browsers may cache preflight responses. 0 = browser default (5 seconds)
+	MaxAge time.Duration
+}
+
+// handles preflight requests (without calling *next*) and adds CORS headers to actual responses
+// from allowed origins. requests from disallowed origins get no CORS headers, which makes the
+// browser deny the app access to the response.
+func CORSMiddleware(policy CORSPolicy) Middleware {
+	if len(policy.AllowedMethods) == 0 {
+		policy.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	// the only case where the response doesn't depend on request's Origin
+	anyOrigin := containsString(policy.AllowedOrigins, "*")
+
+	if anyOrigin && policy.AllowCredentials {
+		panic("CORSMiddleware: AllowedOrigins \"*\" with AllowCredentials would let any site make credentialed requests")
+	}
+
+	originAllowed := func(origin string) bool {
+		if anyOrigin {
+			return true
+		}
+
+		for _, allowed := range policy.AllowedOrigins {
+			if corsOriginMatches(allowed, origin) {
+				return true
+			}
+		}
+
+		return policy.AllowOrigin != nil && policy.AllowOrigin(origin)
+	}
+
+	allowOriginHeaders := func(h http.Header, origin string) {
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if policy.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// caches must not give a response meant for one origin to another
+			if !anyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+				if origin != "" && originAllowed(origin) {
+					corsPreflightHeaders(w.Header(), r, policy, allowOriginHeaders, origin)
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if origin != "" && originAllowed(origin) {
+				allowOriginHeaders(w.Header(), origin)
+
+				if len(policy.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// if requested method or headers are not allowed, no CORS headers are given and the browser fails the preflight
+func corsPreflightHeaders(h http.Header, r *http.Request, policy CORSPolicy, allowOriginHeaders func(http.Header, string), origin string) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !containsString(policy.AllowedMethods, "*") && !containsString(policy.AllowedMethods, method) {
+		return
+	}
+
+	requestedHeaders := []string{}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+			requestedHeaders = append(requestedHeaders, header)
+		}
+	}
+
+	if !containsString(policy.AllowedHeaders, "*") {
+		for _, header := range requestedHeaders {
+			if !containsStringFold(policy.AllowedHeaders, header) {
+				return
+			}
+		}
+	}
+
+	allowOriginHeaders(h, origin)
+
+	// reflecting instead of giving the lists (or "*"), because "*" doesn't work with credentials
+	h.Set("Access-Control-Allow-Methods", method)
+	if len(requestedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+
+	if policy.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge/time.Second)))
+	}
+}
+
+// "https://*.example.com" matches "https://api.example.com" and "https://a.b.example.com" but not "https://example.com"
+func corsOriginMatches(allowed string, origin string) bool {
+	prefix, suffix, isWildcard := strings.Cut(allowed, "*")
+	if !isWildcard {
+		return strings.EqualFold(allowed, origin)
+	}
+
+	origin = strings.ToLower(origin)
+	prefix, suffix = strings.ToLower(prefix), strings.ToLower(suffix)
+
+	if !strings.HasPrefix(suffix, ".") { // only "*." makes sense
+		return false
+	}
+
+	subdomain, found := strings.CutPrefix(origin, prefix)
+	if !found || !strings.HasSuffix(subdomain, suffix) {
+		return false
+	}
+
+	subdomain = strings.TrimSuffix(subdomain, suffix)
+
+	// no "/" or ":" so that f.ex. "https://evil.com/.example.com" can't sneak in
+	return subdomain != "" && !strings.ContainsAny(subdomain, "/:@")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsStringFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+
+	return false
+}
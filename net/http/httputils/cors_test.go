@@ -0,0 +1,169 @@
+package httputils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	handler := CORSMiddleware(CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.net"},
+		AllowOrigin:      func(origin string) bool { return origin == "http://localhost:3000" },
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})(corsTestHandler)
+
+	// actual requests
+	assert.Equal(t, corsRequest(handler, http.MethodGet, "https://app.example.com"), `200
+Access-Control-Allow-Credentials: true
+Access-Control-Allow-Origin: https://app.example.com
+Access-Control-Expose-Headers: X-Request-Id
+Vary: Origin`)
+	assert.Equal(t, corsRequest(handler, http.MethodGet, "http://localhost:3000"), `200
+Access-Control-Allow-Credentials: true
+Access-Control-Allow-Origin: http://localhost:3000
+Access-Control-Expose-Headers: X-Request-Id
+Vary: Origin`)
+	assert.Equal(t, corsRequest(handler, http.MethodGet, "https://evil.com"), `200
+Vary: Origin`)
+	assert.Equal(t, corsRequest(handler, http.MethodGet, ""), `200
+Vary: Origin`)
+
+	// preflights
+	assert.Equal(t, corsRequest(handler, http.MethodOptions, "https://app.example.com", "PUT", "content-type, Authorization"), `204
+Access-Control-Allow-Credentials: true
+Access-Control-Allow-Headers: content-type, authorization
+Access-Control-Allow-Methods: PUT
+Access-Control-Allow-Origin: https://app.example.com
+Access-Control-Max-Age: 600
+Vary: Origin, Access-Control-Request-Method, Access-Control-Request-Headers`)
+	assert.Equal(t, corsRequest(handler, http.MethodOptions, "https://app.example.com", "DELETE", ""), `204
+Vary: Origin, Access-Control-Request-Method, Access-Control-Request-Headers`)
+	assert.Equal(t, corsRequest(handler, http.MethodOptions, "https://app.example.com", "PUT", "X-Custom"), `204
+Vary: Origin, Access-Control-Request-Method, Access-Control-Request-Headers`)
+	assert.Equal(t, corsRequest(handler, http.MethodOptions, "https://evil.com", "PUT", ""), `204
+Vary: Origin, Access-Control-Request-Method, Access-Control-Request-Headers`)
+
+	// plain OPTIONS (not a preflight) goes to the handler
+	assert.Equal(t, corsRequest(handler, http.MethodOptions, "https://app.example.com"), `200
+Access-Control-Allow-Credentials: true
+Access-Control-Allow-Origin: https://app.example.com
+Access-Control-Expose-Headers: X-Request-Id
+Vary: Origin`)
+}
+
+func TestCORSMiddlewareAnyOrigin(t *testing.T) {
+	public := CORSMiddleware(CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"*"},
+	})(corsTestHandler)
+
+	// no credentials => literal "*" and the response is cacheable for all origins
+	assert.Equal(t, corsRequest(public, http.MethodGet, "https://anyone.com"), `200
+Access-Control-Allow-Origin: *`)
+	assert.Equal(t, corsRequest(public, http.MethodOptions, "https://anyone.com", "POST", "X-Anything"), `204
+Access-Control-Allow-Headers: x-anything
+Access-Control-Allow-Methods: POST
+Access-Control-Allow-Origin: *
+Vary: Access-Control-Request-Method, Access-Control-Request-Headers`)
+
+	withCredentials := CORSMiddleware(CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"*"},
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: true,
+	})(corsTestHandler)
+
+	// browsers reject "*" with credentials => methods and headers must be reflected
+	assert.Equal(t, corsRequest(withCredentials, http.MethodOptions, "https://app.example.com", "DELETE", "X-Anything"), `204
+Access-Control-Allow-Credentials: true
+Access-Control-Allow-Headers: x-anything
+Access-Control-Allow-Methods: DELETE
+Access-Control-Allow-Origin: https://app.example.com
+Vary: Origin, Access-Control-Request-Method, Access-Control-Request-Headers`)
+	assert.Equal(t, corsRequest(withCredentials, http.MethodGet, "https://anyone.com"), `200
+Vary: Origin`)
+}
+
+func TestCORSAnyOriginWithCredentialsIsRejected(t *testing.T) {
+	panicked := func() (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+
+		CORSMiddleware(CORSPolicy{
+			AllowedOrigins:   []string{"*"},
+			AllowCredentials: true,
+		})
+		return
+	}()
+
+	assert.Equal(t, panicked, true)
+}
+
+func TestCORSOriginMatches(t *testing.T) {
+	for _, tc := range []struct {
+		allowed string
+		origin  string
+		matches bool
+	}{
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "HTTPS://APP.EXAMPLE.COM", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://api.example.com.evil.com", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://evil.com:1@x.example.com", false},
+		{"https://*.example.com", "http://api.example.com", false},
+		{"https://*example.com", "https://evilexample.com", false}, // malformed pattern matches nothing
+	} {
+		tc := tc
+		t.Run(tc.allowed+" "+tc.origin, func(t *testing.T) {
+			assert.Equal(t, corsOriginMatches(tc.allowed, tc.origin), tc.matches)
+		})
+	}
+}
+
+var corsTestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// returns status and CORS-related headers
+func corsRequest(handler http.Handler, method string, origin string, preflight ...string) string {
+	req := httptest.NewRequest(method, "/", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if len(preflight) == 2 {
+		req.Header.Set("Access-Control-Request-Method", preflight[0])
+		if preflight[1] != "" {
+			req.Header.Set("Access-Control-Request-Headers", preflight[1])
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	lines := []string{}
+	for key, values := range resp.Header() {
+		if strings.HasPrefix(key, "Access-Control-") || key == "Vary" {
+			lines = append(lines, key+": "+strings.Join(values, ", "))
+		}
+	}
+	sort.Strings(lines)
+
+	return strings.Join(append([]string{fmt.Sprint(resp.Code)}, lines...), "\n")
+}
@@ -0,0 +1,162 @@
+package httputils
+
+// Debug endpoints for production troubleshooting. mount at "/debug/" (pprof requires that prefix):
+//
+//	mux.Handle("/debug/", httputils.DebugHandler(httputils.DebugOptions{
+//		Authorize: httputils.AuthorizeBearerToken(os.Getenv("DEBUG_TOKEN")),
+//		LogLevel:  cli.LogLevel,
+//	}))
+
+import (
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"strings"
+
+	"github.com/function61/gokit/app/dynversion"
+	"github.com/function61/gokit/net/http/httpauth"
+)
+
+// returns error if the request is not allowed
+type Authorizer func(r *http.Request) error
+
+type DebugOptions struct {
+	Authorize Authorizer     // required, as debug endpoints expose internals (and pprof can be used for DoS)
+	LogLevel  *slog.LevelVar // optional. enables runtime log level switching. use `cli.LogLevel` for apps made with `cli.Execute()`
+}
+
+// `Authorization: Bearer <token>`
+func AuthorizeBearerToken(token string) Authorizer {
+	return func(r *http.Request) error {
+		given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !found || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return errors.New("invalid bearer token")
+		}
+
+		return nil
+	}
+}
+
+// any user authenticated by *authenticator*
+func AuthorizeAuthenticated(authenticator httpauth.HttpRequestAuthenticator) Authorizer {
+	return func(r *http.Request) error {
+		_, err := authenticator.Authenticate(r)
+		return err
+	}
+}
+
+// pprof, expvar, goroutine dump, build info and log level switching, all behind *opts.Authorize*
+func DebugHandler(opts DebugOptions) http.Handler {
+	if opts.Authorize == nil {
+		panic("DebugHandler: Authorize is required")
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_ = runtimepprof.Lookup("goroutine").WriteTo(w, 2) // 2 = same format as a panic
+	})
+
+	mux.HandleFunc("/debug/buildinfo", func(w http.ResponseWriter, r *http.Request) {
+		RespondJSON(w, debugBuildInfo())
+	})
+
+	mux.Handle("/debug/loglevel", WrapWithErrorHandling(func(w http.ResponseWriter, r *http.Request) error {
+		return serveLogLevel(w, r, opts.LogLevel)
+	}))
+
+	mux.HandleFunc("/debug/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/" {
+			Error(w, http.StatusNotFound)
+			return
+		}
+
+		_, _ = io.WriteString(w, strings.Join([]string{
+			"/debug/pprof/",
+			"/debug/vars",
+			"/debug/goroutines",
+			"/debug/buildinfo",
+			"/debug/loglevel",
+		}, "\n")+"\n")
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := opts.Authorize(r); err != nil {
+			RespondError(w, r, NewHTTPError(http.StatusUnauthorized, "", err))
+			return
+		}
+
+		NoCacheHeaders(w)
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// GET returns current level, POST sets it (`level=debug` as query or form)
+func serveLogLevel(w http.ResponseWriter, r *http.Request, level *slog.LevelVar) error {
+	if level == nil {
+		return NewHTTPError(http.StatusNotFound, "log level switching not enabled", nil)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		newLevel := slog.Level(0)
+		if err := newLevel.UnmarshalText([]byte(r.FormValue("level"))); err != nil {
+			return fmt.Errorf("%w: %v", ErrValidation, err)
+		}
+
+		if previous := level.Level(); previous != newLevel {
+			level.Set(newLevel)
+
+			RequestLogger(r).Warn("log level changed", "from", previous.String(), "to", newLevel.String())
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return NewHTTPError(http.StatusMethodNotAllowed, "", nil)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := io.WriteString(w, level.Level().String()+"\n")
+	return err
+}
+
+type buildInfo struct {
+	Version   string            `json:"version"` // from dynversion
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"` // VCS info, build flags etc.
+}
+
+func debugBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   dynversion.Version,
+		GoVersion: runtime.Version(),
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Path = build.Path
+		info.Settings = map[string]string{}
+		for _, setting := range build.Settings {
+			info.Settings[setting.Key] = setting.Value
+		}
+	}
+
+	return info
+}
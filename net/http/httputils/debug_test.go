@@ -0,0 +1,92 @@
+package httputils
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestDebugHandler(t *testing.T) {
+	level := &slog.LevelVar{}
+
+	handler := DebugHandler(DebugOptions{
+		Authorize: AuthorizeBearerToken("s3cret"),
+		LogLevel:  level,
+	})
+
+	serve := func(method string, path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, serve(http.MethodGet, "/debug/", "").Code, http.StatusUnauthorized)
+	assert.Equal(t, serve(http.MethodGet, "/debug/vars", "wrong").Code, http.StatusUnauthorized)
+	assert.Equal(t, serve(http.MethodPost, "/debug/loglevel?level=debug", "wrong").Code, http.StatusUnauthorized)
+	assert.Equal(t, level.Level(), slog.LevelInfo)
+
+	index := serve(http.MethodGet, "/debug/", "s3cret")
+	assert.Equal(t, index.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(index.Body.String(), "/debug/pprof/\n"), true)
+
+	assert.Equal(t, serve(http.MethodGet, "/debug/nonexistent", "s3cret").Code, http.StatusNotFound)
+
+	vars := serve(http.MethodGet, "/debug/vars", "s3cret")
+	assert.Equal(t, strings.Contains(vars.Body.String(), `"memstats"`), true)
+
+	goroutines := serve(http.MethodGet, "/debug/goroutines", "s3cret")
+	assert.Equal(t, strings.Contains(goroutines.Body.String(), "TestDebugHandler"), true)
+
+	buildInfo := serve(http.MethodGet, "/debug/buildinfo", "s3cret")
+	assert.Equal(t, strings.Contains(buildInfo.Body.String(), `"go_version":"go`), true)
+
+	assert.Equal(t, serve(http.MethodGet, "/debug/pprof/", "s3cret").Code, http.StatusOK)
+
+	// log level
+	assert.Equal(t, serve(http.MethodGet, "/debug/loglevel", "s3cret").Body.String(), "INFO\n")
+	assert.Equal(t, serve(http.MethodPost, "/debug/loglevel?level=debug", "s3cret").Body.String(), "DEBUG\n")
+	assert.Equal(t, level.Level(), slog.LevelDebug)
+
+	assert.Equal(t, serve(http.MethodPost, "/debug/loglevel?level=loud", "s3cret").Code, http.StatusBadRequest)
+	assert.Equal(t, serve(http.MethodDelete, "/debug/loglevel", "s3cret").Code, http.StatusMethodNotAllowed)
+	assert.Equal(t, level.Level(), slog.LevelDebug)
+
+	form := httptest.NewRequest(http.MethodPost, "/debug/loglevel", strings.NewReader(url.Values{"level": {"warn"}}.Encode()))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form.Header.Set("Authorization", "Bearer s3cret")
+	handler.ServeHTTP(httptest.NewRecorder(), form)
+	assert.Equal(t, level.Level(), slog.LevelWarn)
+
+	// not enabled
+	noLevel := DebugHandler(DebugOptions{Authorize: func(*http.Request) error { return nil }})
+	resp := httptest.NewRecorder()
+	noLevel.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/debug/loglevel", nil))
+	assert.Equal(t, resp.Code, http.StatusNotFound)
+}
+
+func TestAuthorizeBearerToken(t *testing.T) {
+	authorize := func(auth Authorizer, header string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		return auth(req) == nil
+	}
+
+	assert.Equal(t, authorize(AuthorizeBearerToken("abc"), "Bearer abc"), true)
+	assert.Equal(t, authorize(AuthorizeBearerToken("abc"), "Bearer abcd"), false)
+	assert.Equal(t, authorize(AuthorizeBearerToken("abc"), "abc"), false)
+	assert.Equal(t, authorize(AuthorizeBearerToken("abc"), ""), false)
+	// empty token must not let requests without a token in
+	assert.Equal(t, authorize(AuthorizeBearerToken(""), "Bearer "), false)
+}
@@ -0,0 +1,111 @@
+package httputils
+
+// Server-side counterpart of `jsonfile.UnmarshalDisallowUnknownFields()` for request bodies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// can be changed, but prefer DecodeJSONLimit() for endpoints that need bigger bodies
+var DefaultMaxJSONBodyBytes int64 = 1024 * 1024
+
+// implement this on your request type to have DecodeJSON() validate it after decoding
+type Validator interface {
+	Validate() error
+}
+
+// decodes request body as JSON into *dst* (limited to DefaultMaxJSONBodyBytes). unknown fields and
+// trailing data are rejected. if *dst* implements Validator, it is validated.
+//
+// the returned errors are HTTPErrors (400, 413 or 415) with messages meant for the client,
+// so they can be returned as-is from handlers wrapped with WrapWithErrorHandling().
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	return DecodeJSONLimit(w, r, dst, DefaultMaxJSONBodyBytes)
+}
+
+// same as DecodeJSON() but with custom body size limit
+func DecodeJSONLimit(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+	if err := requireJSONContentType(r.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return jsonDecodeError(err)
+	}
+
+	// Decode() stops after the first value, so `{"a":1}{"b":2}` or `{"a":1} garbage` would go unnoticed
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return jsonDecodeError(err)
+		}
+
+		return NewHTTPError(http.StatusBadRequest, "request body must contain only one JSON value", err)
+	}
+
+	if validator, ok := dst.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return validationError(err)
+		}
+	}
+
+	return nil
+}
+
+// accepts "application/json" and the "application/*+json" family
+func requireJSONContentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !(mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))) {
+		return NewHTTPError(http.StatusUnsupportedMediaType, fmt.Sprintf("expected Content-Type application/json; got '%s'", contentType), nil)
+	}
+
+	return nil
+}
+
+func jsonDecodeError(err error) error {
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body too large (max %d bytes)", maxBytesErr.Limit), err)
+	case errors.As(err, &syntaxErr):
+		return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset), err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewHTTPError(http.StatusBadRequest, "malformed JSON: unexpected end of body", err)
+	case errors.As(err, &typeErr):
+		return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("field '%s' must be of type %s", typeErr.Field, typeErr.Type.String()), err)
+	case errors.Is(err, io.EOF):
+		return NewHTTPError(http.StatusBadRequest, "request body is empty", err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "): // sadly there's no error type for this
+		return NewHTTPError(http.StatusBadRequest, strings.TrimPrefix(err.Error(), "json: "), err)
+	default:
+		return NewHTTPError(http.StatusBadRequest, "malformed JSON", err)
+	}
+}
+
+func validationError(err error) error {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) { // validator knows best
+		return err
+	}
+
+	msg := err.Error()
+	if !errors.Is(err, ErrValidation) {
+		msg = ErrValidation.Error() + ": " + msg
+	}
+
+	return NewHTTPError(http.StatusBadRequest, msg, err)
+}
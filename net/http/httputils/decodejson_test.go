@@ -0,0 +1,71 @@
+package httputils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+type testCreateUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (c testCreateUser) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+
+	return nil
+}
+
+func TestDecodeJSON(t *testing.T) {
+	decode := func(contentType string, body string) (testCreateUser, string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		user := testCreateUser{}
+		if err := DecodeJSONLimit(httptest.NewRecorder(), req, &user, 64); err != nil {
+			httpErr := httpErrorFrom(err)
+			return user, http.StatusText(httpErr.StatusCode) + ": " + httpErr.Message
+		}
+
+		return user, ""
+	}
+
+	user, errStr := decode("application/json; charset=utf-8", `{"name": "Joonas", "age": 30}`)
+	assert.Equal(t, errStr, "")
+	assert.Equal(t, user.Name, "Joonas")
+	assert.Equal(t, user.Age, 30)
+
+	for _, tc := range []struct {
+		contentType string
+		body        string
+		expectedErr string
+	}{
+		{"application/merge-patch+json", `{"name": "Joonas"}`, ""},
+		{"", `{"name": "Joonas"}`, "Unsupported Media Type: expected Content-Type application/json; got ''"},
+		{"text/plain", `{"name": "Joonas"}`, "Unsupported Media Type: expected Content-Type application/json; got 'text/plain'"},
+		{"application/json", ``, "Bad Request: request body is empty"},
+		{"application/json", `{"name": "Joonas",}`, "Bad Request: malformed JSON at offset 19"},
+		{"application/json", `{"name": "Joonas"`, "Bad Request: malformed JSON: unexpected end of body"},
+		{"application/json", `{"name": "Joonas", "age": "30"}`, "Bad Request: field 'age' must be of type int"},
+		{"application/json", `{"name": "Joonas", "admin": true}`, `Bad Request: unknown field "admin"`},
+		{"application/json", `{"name": "Joonas"} {"name": "Other"}`, "Bad Request: request body must contain only one JSON value"},
+		{"application/json", `{"name": "Joonas"} trailing`, "Bad Request: request body must contain only one JSON value"},
+		{"application/json", `{"name": ""}`, "Bad Request: validation failed: name is required"},
+		{"application/json", `{"name": "` + strings.Repeat("x", 64) + `"}`, "Request Entity Too Large: request body too large (max 64 bytes)"},
+	} {
+		tc := tc
+		t.Run(tc.body, func(t *testing.T) {
+			_, errStr := decode(tc.contentType, tc.body)
+			assert.Equal(t, errStr, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package httputils
+
+// Errors that know how they should be shown to the client. WrapWithErrorHandling() responds to them
+// with RFC 9457 "problem details" JSON: https://www.rfc-editor.org/rfc/rfc9457
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const ProblemJSONContentType = "application/problem+json"
+
+// common errors that map to a status code. wrap them to add details:
+//
+//	fmt.Errorf("%w: name is required", httputils.ErrValidation)
+var (
+	ErrValidation   = errors.New("validation failed") // 400. message of the (above-like) wrap is shown to the client
+	ErrUnauthorized = errors.New("unauthorized")      // 401
+	ErrForbidden    = errors.New("forbidden")         // 403
+	ErrNotFound     = errors.New("not found")         // 404 (as is `fs.ErrNotExist`)
+	ErrConflict     = errors.New("conflict")          // 409
+)
+
+// error with a status code and a message that is safe to show to the client. *Cause* is only logged.
+type HTTPError struct {
+	StatusCode int
+	Message    string // shown to the client. if empty, the status text is used
+	Cause      error  // internal details. optional
+}
+
+func NewHTTPError(statusCode int, message string, cause error) *HTTPError {
+	return &HTTPError{
+		StatusCode: statusCode,
+		Message:    message,
+		Cause:      cause,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+
+	if e.Cause != nil {
+		return msg + ": " + e.Cause.Error()
+	}
+
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Cause
+}
+
+// response body for errors
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // extension member, so the client can give us something to look for in the logs
+}
+
+// responds with problem+json for *err*. the error is logged with RequestLogger() (5xx as errors).
+// nothing is written if the response was already started or the connection hijacked (the error is still logged).
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
+	httpErr := httpErrorFrom(err)
+
+	level := slog.LevelInfo
+	if httpErr.StatusCode >= 500 {
+		level = slog.LevelError
+	}
+
+	RequestLogger(r).Log(r.Context(), level, "request failed",
+		"status", httpErr.StatusCode,
+		"error", err.Error())
+
+	if recorder, is := w.(*ResponseRecorder); is && (recorder.HeaderWritten() || recorder.Hijacked()) {
+		return
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(httpErr.StatusCode),
+		Status:    httpErr.StatusCode,
+		Detail:    httpErr.Message,
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", ProblemJSONContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(httpErr.StatusCode)
+
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// typed errors as-is, sentinel errors to their status codes and everything else to a 500 without details
+func httpErrorFrom(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode != 0 {
+		return httpErr
+	}
+
+	switch {
+	case errors.Is(err, ErrValidation):
+		return &HTTPError{StatusCode: http.StatusBadRequest, Message: validationMessage(err)}
+	case errors.Is(err, ErrUnauthorized):
+		return &HTTPError{StatusCode: http.StatusUnauthorized}
+	case errors.Is(err, ErrForbidden):
+		return &HTTPError{StatusCode: http.StatusForbidden}
+	case errors.Is(err, ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return &HTTPError{StatusCode: http.StatusNotFound}
+	case errors.Is(err, ErrConflict):
+		return &HTTPError{StatusCode: http.StatusConflict}
+	default:
+		return &HTTPError{StatusCode: http.StatusInternalServerError} // don't leak internals
+	}
+}
+
+// message of the error that directly wraps ErrValidation (like documented, with ErrValidation first),
+// so that other wraps (which can have internal details like "insert user: db=10.0.0.5: ...")
+// are not shown to the client
+func validationMessage(err error) string {
+	wrapsDirectly := func(inner error) bool {
+		return inner == ErrValidation && strings.HasPrefix(err.Error(), ErrValidation.Error())
+	}
+
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() error }:
+		if wrapsDirectly(wrapped.Unwrap()) {
+			return err.Error()
+		}
+
+		return validationMessage(wrapped.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, inner := range wrapped.Unwrap() {
+			if wrapsDirectly(inner) {
+				return err.Error()
+			}
+		}
+
+		for _, inner := range wrapped.Unwrap() {
+			if errors.Is(inner, ErrValidation) {
+				return validationMessage(inner)
+			}
+		}
+	}
+
+	return ErrValidation.Error()
+}
@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestWrapWithErrorHandling(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	errToReturn := error(nil)
+
+	handler := Chain(withTestLogger(logs), RequestIDMiddleware)(WrapWithErrorHandling(func(w http.ResponseWriter, r *http.Request) error {
+		return errToReturn
+	}))
+
+	serve := func(err error) (*httptest.ResponseRecorder, string) {
+		logs.Reset()
+		errToReturn = err
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "req1")
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp, logs.String()
+	}
+
+	resp, logged := serve(errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	assert.Equal(t, resp.Code, http.StatusInternalServerError)
+	assert.Equal(t, resp.Header().Get("Content-Type"), "application/problem+json")
+	assert.EqualJSON(t, decodeProblem(t, resp), `{
+  "type": "about:blank",
+  "title": "Internal Server Error",
+  "status": 500,
+  "request_id": "req1"
+}`)
+	assert.Equal(t, logged, `level=ERROR msg="request failed" request_id=req1 status=500 error="dial tcp 10.0.0.5:5432: connection refused"`+"\n")
+
+	resp, logged = serve(NewHTTPError(http.StatusTooManyRequests, "slow down", errors.New("user 123 exceeded quota")))
+	assert.Equal(t, resp.Code, http.StatusTooManyRequests)
+	assert.EqualJSON(t, decodeProblem(t, resp), `{
+  "type": "about:blank",
+  "title": "Too Many Requests",
+  "status": 429,
+  "detail": "slow down",
+  "request_id": "req1"
+}`)
+	assert.Equal(t, logged, `level=INFO msg="request failed" request_id=req1 status=429 error="slow down: user 123 exceeded quota"`+"\n")
+
+	resp, _ = serve(fmt.Errorf("%w: name is required", ErrValidation))
+	assert.Equal(t, resp.Code, http.StatusBadRequest)
+	assert.Matches(t, resp.Body.String(), `"detail":"validation failed: name is required"`)
+
+	// outer wraps can have internal details
+	resp, logged = serve(fmt.Errorf("insert user: db=10.0.0.5: %w", fmt.Errorf("%w: name is required", ErrValidation)))
+	assert.Equal(t, resp.Code, http.StatusBadRequest)
+	assert.Equal(t, decodeProblem(t, resp).Detail, "validation failed: name is required")
+	assert.Equal(t, logged, `level=INFO msg="request failed" request_id=req1 status=400 error="insert user: db=10.0.0.5: validation failed: name is required"`+"\n")
+
+	resp, _ = serve(fmt.Errorf("insert user: %w", ErrValidation))
+	assert.Equal(t, decodeProblem(t, resp).Detail, "validation failed")
+
+	resp, _ = serve(fmt.Errorf("loading user: %w", ErrNotFound))
+	assert.Equal(t, resp.Code, http.StatusNotFound)
+	assert.Matches(t, resp.Body.String(), `"title":"Not Found","status":404,"request_id"`)
+}
+
+func TestWrapWithErrorHandlingResponseAlreadyStarted(t *testing.T) {
+	handler := WrapWithErrorHandling(func(w http.ResponseWriter, r *http.Request) error {
+		_, _ = io.WriteString(w, "partial")
+		return errors.New("stream broke")
+	})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "partial")
+}
+
+func TestWrapWithErrorHandlingHijacked(t *testing.T) {
+	handled := make(chan struct{})
+
+	handler := WrapWithErrorHandling(func(w http.ResponseWriter, r *http.Request) error {
+		conn, bufrw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		_, _ = bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = bufrw.Flush()
+
+		return errors.New("peer went away")
+	})
+
+	serverLogs := &bytes.Buffer{}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handled)
+		handler.ServeHTTP(w, r)
+	}))
+	server.Config.ErrorLog = log.New(serverLogs, "", 0)
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Ok(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Ok(t, err)
+	assert.Equal(t, string(body), "hijacked")
+
+	<-handled
+	// net/http complains if we try to respond to hijacked connection
+	assert.Equal(t, serverLogs.String(), "")
+}
+
+func TestWrapWithErrorHandlingReadFrom(t *testing.T) {
+	handler := WrapWithErrorHandling(func(w http.ResponseWriter, r *http.Request) error {
+		recorder := w.(*ResponseRecorder)
+
+		// LimitReader doesn't implement `io.WriterTo`, so `io.Copy()` uses our `io.ReaderFrom`
+		if _, err := io.Copy(w, io.LimitReader(strings.NewReader("hello world"), 5)); err != nil {
+			return err
+		}
+
+		assert.Equal(t, recorder.Status(), http.StatusOK)
+		assert.Equal(t, recorder.BytesWritten(), int64(5))
+		return nil
+	})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, resp.Body.String(), "hello")
+}
+
+func decodeProblem(t *testing.T, resp *httptest.ResponseRecorder) Problem {
+	t.Helper()
+
+	problem := Problem{}
+	assert.Ok(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+	return problem
+}
@@ -0,0 +1,162 @@
+package httputils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	DefaultIdleTimeout  = 120 * time.Second
+	DefaultWriteTimeout = 5 * time.Minute // long-running handlers (streaming etc.) can extend with `http.ResponseController.SetWriteDeadline()`
+	DefaultDrainTimeout = 30 * time.Second
+)
+
+type GracefulOptions struct {
+	// how long in-flight requests get to finish after we stop accepting new ones. after this the
+	// remaining connections are closed forcibly. defaults to DefaultDrainTimeout
+	DrainTimeout time.Duration
+	// after the shutdown is requested, keep serving (with Readiness reporting unhealthy) for this long,
+	// so that the load balancer has time to notice and stop sending us new requests
+	PreShutdownDelay time.Duration
+	Readiness        *Readiness // optional
+}
+
+type shuttingDownKey struct{}
+
+// closed when the server (run with GracefulServer() or CancelableServer()) starts draining. long-lived
+// requests (streams, long polls) should end on it, because shutdown doesn't cancel request contexts
+// and they'd hold up the drain. nil channel (= never) for requests not served by those.
+func ShuttingDown(ctx context.Context) <-chan struct{} {
+	shuttingDown, _ := ctx.Value(shuttingDownKey{}).(chan struct{})
+	return shuttingDown
+}
+
+// reports if the server should receive traffic. zero value is ready. safe for concurrent use.
+//
+//	mux.Handle("/readyz", readiness)
+type Readiness struct {
+	notReady atomic.Bool
+}
+
+var _ http.Handler = (*Readiness)(nil)
+
+func (r *Readiness) SetReady(ready bool) {
+	r.notReady.Store(!ready)
+}
+
+func (r *Readiness) IsReady() bool {
+	return !r.notReady.Load()
+}
+
+// 200 if ready, 503 if not
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	NoCacheHeaders(w)
+
+	if r.IsReady() {
+		_, _ = io.WriteString(w, "ready\n")
+	} else {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+	}
+}
+
+// like CancelableServer(), but also applies default timeouts to *srv* (for those that are not set)
+// and supports a pre-shutdown delay for load balancer deregistration:
+//
+//	err := httputils.GracefulServer(ctx, srv, func() error { return srv.ListenAndServe() }, httputils.GracefulOptions{
+//		PreShutdownDelay: 5 * time.Second,
+//		Readiness:        readiness,
+//	})
+func GracefulServer(ctx context.Context, srv *http.Server, serve func() error, opts GracefulOptions) error {
+	ApplyDefaultTimeouts(srv)
+
+	return serveGracefully(ctx, srv, serve, opts)
+}
+
+// sets timeouts that are not set (= zero) to our defaults
+func ApplyDefaultTimeouts(srv *http.Server) {
+	if srv.ReadHeaderTimeout == 0 {
+		srv.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+
+	if srv.IdleTimeout == 0 {
+		srv.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if srv.WriteTimeout == 0 {
+		srv.WriteTimeout = DefaultWriteTimeout
+	}
+}
+
+func serveGracefully(ctx context.Context, srv *http.Server, serve func() error, opts GracefulOptions) error {
+	if opts.DrainTimeout == 0 {
+		opts.DrainTimeout = DefaultDrainTimeout
+	}
+
+	shuttingDown := make(chan struct{})
+
+	// request contexts derive from this
+	baseContext := srv.BaseContext
+	srv.BaseContext = func(listener net.Listener) context.Context {
+		base := context.Background()
+		if baseContext != nil {
+			base = baseContext(listener)
+		}
+
+		return context.WithValue(base, shuttingDownKey{}, shuttingDown)
+	}
+
+	shutdownerCtx, cancel := context.WithCancel(ctx)
+
+	shutdownResult := make(chan error, 1)
+
+	go func() {
+		// triggered by parent cancellation (or below for cleanup if serve() failed by itself)
+		<-shutdownerCtx.Done()
+
+		if ctx.Err() != nil { // actual shutdown request (not cleanup)
+			if opts.Readiness != nil {
+				opts.Readiness.SetReady(false)
+			}
+
+			if opts.PreShutdownDelay > 0 {
+				srv.SetKeepAlivesEnabled(false) // nudges clients to reconnect elsewhere
+				time.Sleep(opts.PreShutdownDelay)
+			}
+		}
+
+		close(shuttingDown)
+
+		// can't use parent ctx b/c it'd cancel the Shutdown() itself
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), opts.DrainTimeout)
+		defer cancelDrain()
+
+		if err := srv.Shutdown(drainCtx); err != nil {
+			_ = srv.Close() // forcibly closes hung connections
+
+			shutdownResult <- fmt.Errorf("drain timeout (%s) exceeded, closed remaining connections: %w", opts.DrainTimeout, err)
+			return
+		}
+
+		shutdownResult <- nil
+	}()
+
+	err := serve()
+
+	// ask shutdowner to stop. this is useful only for cleanup where listener failed before
+	// it was requested to shut down b/c parent cancellation didn't happen and thus the
+	// shutdowner would still wait.
+	cancel()
+
+	if err == http.ErrServerClosed { // expected for graceful shutdown (not actually error)
+		return <-shutdownResult // nil, unless drain timed out
+	} else {
+		// some other error
+		// (or nil, but http server should always exit with non-nil error)
+		return err
+	}
+}
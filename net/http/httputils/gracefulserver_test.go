@@ -0,0 +1,76 @@
+package httputils
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestGracefulServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Ok(t, err)
+	baseURL := "http://" + listener.Addr().String()
+
+	readiness := &Readiness{}
+
+	hungRequestStarted := make(chan struct{})
+	hungRequestRelease := make(chan struct{})
+	defer close(hungRequestRelease) // so the handler's goroutine doesn't outlive the test
+
+	mux := http.NewServeMux()
+	mux.Handle("/readyz", readiness)
+	mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+		close(hungRequestStarted)
+		<-hungRequestRelease // ignores shutdown
+	})
+
+	srv := &http.Server{Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- GracefulServer(ctx, srv, func() error { return srv.Serve(listener) }, GracefulOptions{
+			DrainTimeout:     100 * time.Millisecond,
+			PreShutdownDelay: 200 * time.Millisecond,
+			Readiness:        readiness,
+		})
+	}()
+
+	get := func(path string) string {
+		resp, err := http.Get(baseURL + path)
+		if err != nil {
+			return "error"
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.Status + ": " + string(body)
+	}
+
+	assert.Equal(t, get("/readyz"), "200 OK: ready\n")
+
+	hungRequestResult := make(chan string, 1)
+	go func() { hungRequestResult <- get("/hang") }()
+	<-hungRequestStarted
+
+	shutdownStarted := time.Now()
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+	// still serving during the pre-shutdown delay, but telling load balancer to go away
+	assert.Equal(t, get("/readyz"), "503 Service Unavailable: not ready\n")
+
+	err = <-result
+	assert.Matches(t, err.Error(), `^drain timeout \(100ms\) exceeded, closed remaining connections: context deadline exceeded$`)
+	assert.Equal(t, time.Since(shutdownStarted) < 2*time.Second, true)
+	assert.Equal(t, <-hungRequestResult, "error")
+
+	assert.Equal(t, srv.ReadHeaderTimeout, DefaultReadHeaderTimeout)
+	assert.Equal(t, srv.WriteTimeout, DefaultWriteTimeout)
+}
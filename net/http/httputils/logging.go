@@ -0,0 +1,28 @@
+package httputils
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type loggerContextKey struct{}
+
+// attaches a request-scoped logger (f.ex. with request/trace ids) to the context. see RequestLogger()
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// returns the request-scoped logger set up by middlewares, or `slog.Default()` if there isn't one
+func RequestLogger(r *http.Request) *slog.Logger {
+	return LoggerFromContext(r.Context())
+}
+
+// same as RequestLogger() but for code that only has the context
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
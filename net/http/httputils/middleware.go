@@ -0,0 +1,297 @@
+package httputils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/function61/gokit/crypto/cryptoutil"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+type Middleware func(http.Handler) http.Handler
+
+// composes *middlewares* into one. the first one is the outermost, i.e. sees the request first:
+//
+//	handler := httputils.Chain(RequestIDMiddleware, AccessLogMiddleware, RecoverMiddleware)(mux)
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+
+		return next
+	}
+}
+
+type requestIDContextKey struct{}
+
+// returns "" if the request didn't go through RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// uses the incoming `X-Request-Id` (f.ex. from a load balancer) or generates a new one.
+// the id is echoed in the response header, available via RequestIDFromContext() and attached to RequestLogger().
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = cryptoutil.RandHex(16)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		ctx = WithLogger(ctx, RequestLogger(r).With("request_id", id))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// logs each request (after it's done) to RequestLogger()
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		recorder := NewResponseRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		RequestLogger(r).LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.RequestURI()),
+			slog.Int("status", recorder.Status()),
+			slog.Int64("bytes", recorder.BytesWritten()),
+			slog.Duration("duration", time.Since(started)),
+			slog.String("remote", r.RemoteAddr))
+	})
+}
+
+// turns panics into 500 responses (if the response wasn't started yet) and logs the stack to RequestLogger().
+// `http.ErrAbortHandler` is re-panicked as it's the standard way to abort the response.
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := NewResponseRecorder(w)
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			if rec == http.ErrAbortHandler { // net/http compares the same way
+				panic(rec)
+			}
+
+			RequestLogger(r).Error("panic in HTTP handler",
+				"panic", fmt.Sprint(rec),
+				"stack", string(debug.Stack()))
+
+			if !recorder.HeaderWritten() && !recorder.Hijacked() {
+				Error(recorder, http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// writes access log in Common Log Format (what Apache and nginx write by default) to *out*
+func CommonLogFormatMiddleware(out io.Writer) Middleware {
+	return logFormatMiddleware(out, false)
+}
+
+// Common Log Format + referer and user agent
+func CombinedLogFormatMiddleware(out io.Writer) Middleware {
+	return logFormatMiddleware(out, true)
+}
+
+func logFormatMiddleware(out io.Writer, combined bool) Middleware {
+	outMu := sync.Mutex{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := time.Now()
+
+			recorder := NewResponseRecorder(w)
+
+			next.ServeHTTP(recorder, r)
+
+			line := formatCommonLogLine(r, started, recorder.Status(), recorder.BytesWritten(), combined)
+
+			outMu.Lock()
+			defer outMu.Unlock()
+
+			_, _ = io.WriteString(out, line)
+		})
+	}
+}
+
+// `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`
+func formatCommonLogLine(r *http.Request, started time.Time, status int, bytesWritten int64, combined bool) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	user := "-"
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = username
+	}
+
+	size := "-"
+	if bytesWritten > 0 {
+		size = strconv.FormatInt(bytesWritten, 10)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		dashIfEmpty(host),
+		logFormatEscape(user),
+		started.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method,
+		logFormatEscape(r.URL.RequestURI()),
+		r.Proto,
+		status,
+		size)
+
+	if combined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"",
+			logFormatEscape(dashIfEmpty(r.Referer())),
+			logFormatEscape(dashIfEmpty(r.UserAgent())))
+	}
+
+	return line + "\n"
+}
+
+// wraps http.ResponseWriter to capture the status and response size. supports
+// `http.ResponseController` (for flushing, hijacking etc.) via Unwrap().
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int64
+	hijacked     bool
+}
+
+var _ interface {
+	http.Flusher
+	http.Hijacker
+	io.ReaderFrom
+} = (*ResponseRecorder)(nil)
+
+// if *w* already is a ResponseRecorder, it is returned as-is (so stacked middlewares share it)
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	if recorder, is := w.(*ResponseRecorder); is {
+		return recorder
+	}
+
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+func (r *ResponseRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 && (statusCode < 100 || statusCode > 199) { // 1xx are informational, not final
+		r.status = statusCode
+	}
+
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *ResponseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(data)
+	r.bytesWritten += int64(n)
+	return n, err
+}
+
+// keeps `io.Copy()` to the response efficient (f.ex. sendfile for files), as net/http's writer supports it
+func (r *ResponseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := io.Copy(r.ResponseWriter, src)
+	r.bytesWritten += n
+	return n, err
+}
+
+// for old code that type asserts `http.Flusher` instead of using `http.ResponseController`
+func (r *ResponseRecorder) Flush() {
+	_ = http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// for old code (f.ex. WebSocket libraries) that type asserts `http.Hijacker`
+func (r *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+
+	return conn, rw, err
+}
+
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// 200 if handler didn't write anything (that's what net/http responds with)
+func (r *ResponseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
+
+func (r *ResponseRecorder) BytesWritten() int64 {
+	return r.bytesWritten
+}
+
+func (r *ResponseRecorder) HeaderWritten() bool {
+	return r.status != 0
+}
+
+// connection was taken over by the handler, so the response can't be written to anymore
+func (r *ResponseRecorder) Hijacked() bool {
+	return r.hijacked
+}
+
+// accept only sane ids, so clients can't inject anything weird into our logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func logFormatEscape(s string) string {
+	return strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,137 @@
+package httputils
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestMiddlewares(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	handler := Chain(
+		withTestLogger(logs),
+		RequestIDMiddleware,
+		AccessLogMiddleware,
+		RecoverMiddleware,
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panic":
+			panic("oh no")
+		case "/missing":
+			Error(w, http.StatusNotFound)
+		default:
+			_, _ = io.WriteString(w, "hello "+RequestIDFromContext(r.Context()))
+		}
+	}))
+
+	serve := func(path string, requestID string) *httptest.ResponseRecorder {
+		logs.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve("/hello?foo=bar", "abc-123")
+	assert.Equal(t, resp.Body.String(), "hello abc-123")
+	assert.Equal(t, resp.Header().Get(RequestIDHeader), "abc-123")
+	assert.Equal(t, logs.String(), "level=INFO msg=request request_id=abc-123 method=GET path=\"/hello?foo=bar\" status=200 bytes=13 duration=<d> remote=192.0.2.1:1234\n")
+
+	resp = serve("/missing", "bad\nid")
+	assert.Equal(t, len(resp.Header().Get(RequestIDHeader)), 32) // generated
+	assert.Matches(t, logs.String(), "status=404 bytes=10 ")
+
+	resp = serve("/panic", "")
+	assert.Equal(t, resp.Code, http.StatusInternalServerError)
+	assert.Equal(t, resp.Body.String(), "Internal Server Error\n")
+	assert.Matches(t, logs.String(), `level=ERROR msg="panic in HTTP handler" request_id=.+ panic="oh no" stack=.+middleware_test.go`)
+	assert.Matches(t, logs.String(), "msg=request .+ status=500")
+}
+
+func TestRecoverMiddlewareResponseAlreadyStarted(t *testing.T) {
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("too late to change status")
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, resp.Code, http.StatusAccepted)
+	assert.Equal(t, resp.Body.String(), "")
+}
+
+func TestMiddlewaresHijack(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	handler := Chain(
+		withTestLogger(logs),
+		AccessLogMiddleware,
+		RecoverMiddleware,
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, bufrw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		defer conn.Close()
+
+		_, _ = bufrw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = bufrw.Flush()
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Ok(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Ok(t, err)
+	assert.Equal(t, string(body), "hijacked")
+}
+
+func TestCombinedLogFormatMiddleware(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	handler := CombinedLogFormatMiddleware(logs)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodDelete, "/items/1", nil)
+	req.SetBasicAuth("frank", "secret")
+	req.Header.Set("User-Agent", `curl "8"`)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Matches(t, logs.String(), `^192\.0\.2\.1 - frank \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "DELETE /items/1 HTTP/1\.1" 204 - "-" "curl \\"8\\""\n$`)
+}
+
+func withTestLogger(out io.Writer) Middleware {
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.Attr{}
+			case "duration": // not deterministic
+				return slog.String("duration", "<d>")
+			}
+			return a
+		},
+	}))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithLogger(r.Context(), logger)))
+		})
+	}
+}
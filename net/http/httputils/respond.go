@@ -0,0 +1,401 @@
+package httputils
+
+// Content negotiation, so the same endpoint serves programs (JSON), streaming consumers (NDJSON),
+// spreadsheets (CSV) and humans:
+//
+//	curl -H 'Accept: text/csv' https://example.com/api/users
+//	curl 'https://example.com/api/users?pretty'
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	PrettyQueryParam  = "pretty" // "?pretty" indents JSON
+	NDJSONContentType = "application/x-ndjson"
+)
+
+var (
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type responseFormat struct {
+	mediaType   string // for matching against `Accept`
+	contentType string
+	encode      func(buf *bytes.Buffer, data reflect.Value, pretty bool) error
+}
+
+// responds with the format (by `Accept` header) best suited for the client. formats:
+//
+//   - application/json (the default, i.e. if the client accepts anything)
+//   - application/x-ndjson for slices, one item per line
+//   - text/csv for slices of structs (that are not text-like, see below). columns are named like in JSON (embedded structs are flattened)
+//   - text/plain for strings, numbers, `fmt.Stringer`s, `encoding.TextMarshaler`s (and slices of them, one per line)
+//
+// quality values are respected (ties go to the order above). if none of the formats is acceptable,
+// responds with 406.
+func Respond(w http.ResponseWriter, r *http.Request, data any) {
+	w.Header().Add("Vary", "Accept")
+
+	formats := responseFormatsFor(data)
+
+	format := negotiateResponseFormat(r.Header.Get("Accept"), formats)
+	if format == nil {
+		supported := []string{}
+		for _, offered := range formats {
+			supported = append(supported, offered.mediaType)
+		}
+
+		RespondError(w, r, NewHTTPError(http.StatusNotAcceptable, "supported types: "+strings.Join(supported, ", "), nil))
+		return
+	}
+
+	// buffered so that encoding errors can still be responded with a proper status code
+	buf := &bytes.Buffer{}
+	if err := format.encode(buf, reflect.ValueOf(data), prettyRequested(r)); err != nil {
+		RespondError(w, r, fmt.Errorf("Respond: %s: %w", format.mediaType, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// formats in order of our preference
+func responseFormatsFor(data any) []responseFormat {
+	formats := []responseFormat{{"application/json", "application/json", encodeResponseJSON}}
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	isList := (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 // []byte is not a list
+
+	if isList {
+		formats = append(formats, responseFormat{NDJSONContentType, NDJSONContentType, encodeResponseNDJSON})
+
+		// structs with text representation (like `time.Time`) are values, not records
+		if itemType := v.Type().Elem(); derefType(itemType).Kind() == reflect.Struct && !textableType(itemType) {
+			formats = append(formats, responseFormat{"text/csv", "text/csv; charset=utf-8", encodeResponseCSV})
+		}
+	}
+
+	if v.IsValid() && (textableType(v.Type()) || isList && textableType(v.Type().Elem())) {
+		formats = append(formats, responseFormat{"text/plain", "text/plain; charset=utf-8", encodeResponseText})
+	}
+
+	return formats
+}
+
+func encodeResponseJSON(buf *bytes.Buffer, data reflect.Value, pretty bool) error {
+	enc := json.NewEncoder(buf)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+
+	if !data.IsValid() { // nil
+		return enc.Encode(nil)
+	}
+
+	return enc.Encode(data.Interface())
+}
+
+func encodeResponseNDJSON(buf *bytes.Buffer, data reflect.Value, _ bool) error {
+	list := reflect.Indirect(data)
+
+	enc := json.NewEncoder(buf)
+	for i := 0; i < list.Len(); i++ {
+		if err := enc.Encode(list.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeResponseCSV(buf *bytes.Buffer, data reflect.Value, _ bool) error {
+	list := reflect.Indirect(data)
+	columns := csvColumns(derefType(list.Type().Elem()), nil)
+
+	csvWriter := csv.NewWriter(buf)
+
+	header := []string{}
+	for _, column := range columns {
+		header = append(header, column.name)
+	}
+
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+
+	for i := 0; i < list.Len(); i++ {
+		item := reflect.Indirect(list.Index(i))
+
+		row := make([]string, len(columns)) // nil item = row of empty cells
+		if item.IsValid() {
+			for j, column := range columns {
+				field, err := item.FieldByIndexErr(column.index)
+				if err != nil { // nil embedded struct pointer
+					continue
+				}
+
+				if row[j], err = csvCell(field); err != nil {
+					return fmt.Errorf("%s: %w", column.name, err)
+				}
+			}
+		}
+
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func encodeResponseText(buf *bytes.Buffer, data reflect.Value, _ bool) error {
+	if !textableType(data.Type()) { // list
+		list := reflect.Indirect(data)
+		for i := 0; i < list.Len(); i++ {
+			line, err := textOf(list.Index(i))
+			if err != nil {
+				return err
+			}
+
+			buf.WriteString(line + "\n")
+		}
+
+		return nil
+	}
+
+	text, err := textOf(data)
+	if err != nil {
+		return err
+	}
+
+	buf.WriteString(text)
+	if !strings.HasSuffix(text, "\n") { // so terminal prompt isn't left on the same line
+		buf.WriteString("\n")
+	}
+
+	return nil
+}
+
+type csvColumn struct {
+	name  string
+	index []int // for `FieldByIndex()`
+}
+
+func csvColumns(structType reflect.Type, parentIndex []int) []csvColumn {
+	columns := []csvColumn{}
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		index := append(append([]int{}, parentIndex...), i)
+
+		// like encoding/json, untagged embedded structs' fields are promoted
+		if field.Anonymous && name == "" && derefType(field.Type).Kind() == reflect.Struct {
+			columns = append(columns, csvColumns(derefType(field.Type), index)...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		columns = append(columns, csvColumn{name: name, index: index})
+	}
+
+	return columns
+}
+
+// values that don't have a text representation (structs, maps, slices) are JSON-encoded
+func csvCell(v reflect.Value) (string, error) {
+	if textableType(v.Type()) {
+		return textOf(v)
+	}
+
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return "", nil
+	}
+
+	asJSON, err := json.Marshal(v.Interface())
+	return string(asJSON), err
+}
+
+func textableType(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) || t.Implements(stringerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return textableType(t.Elem())
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// nil pointers are empty text
+func textOf(v reflect.Value) (string, error) {
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return "", nil
+	}
+
+	if v.CanInterface() {
+		switch value := v.Interface().(type) {
+		case encoding.TextMarshaler: // preferred, as f.ex. `time.Time.String()` is meant for debugging
+			text, err := value.MarshalText()
+			return string(text), err
+		case fmt.Stringer:
+			return value.String(), nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return textOf(v.Elem())
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("no text representation for %s", v.Type())
+	}
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// "?pretty", "?pretty=1", "?pretty=true"
+func prettyRequested(r *http.Request) bool {
+	values, has := r.URL.Query()[PrettyQueryParam]
+	if !has {
+		return false
+	}
+
+	pretty, err := strconv.ParseBool(values[0])
+	return values[0] == "" || (err == nil && pretty)
+}
+
+// returns nil if none of *formats* is acceptable
+func negotiateResponseFormat(accept string, formats []responseFormat) *responseFormat {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 { // no (valid) header = accepts anything
+		return &formats[0]
+	}
+
+	var best *responseFormat
+	bestQuality := 0.0
+	for i := range formats {
+		// strictly greater, so ties go to our preference
+		if quality := acceptQuality(ranges, formats[i].mediaType); quality > bestQuality {
+			best, bestQuality = &formats[i], quality
+		}
+	}
+
+	return best
+}
+
+type acceptRange struct {
+	mediaType string // "text/csv", "text/*" or "*/*"
+	quality   float64
+}
+
+// "text/csv;q=0.5, application/json" => [{text/csv 0.5} {application/json 1}]. malformed ranges are ignored.
+func parseAccept(accept string) []acceptRange {
+	ranges := []acceptRange{}
+
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if !strings.Contains(mediaType, "/") {
+			continue
+		}
+
+		rng := acceptRange{mediaType: mediaType, quality: 1}
+
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if !strings.EqualFold(key, "q") {
+				continue
+			}
+
+			quality, err := strconv.ParseFloat(value, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				rng.mediaType = "" // malformed
+			}
+
+			rng.quality = quality
+		}
+
+		if rng.mediaType != "" {
+			ranges = append(ranges, rng)
+		}
+	}
+
+	return ranges
+}
+
+// quality of the most specific range matching *mediaType*. 0 = not acceptable
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	quality := 0.0
+	bestSpecificity := -1
+	for _, rng := range ranges {
+		specificity := -1
+		switch rng.mediaType {
+		case mediaType:
+			specificity = 2
+		case typ + "/*":
+			specificity = 1
+		case "*/*":
+			specificity = 0
+		}
+
+		if specificity > bestSpecificity {
+			quality, bestSpecificity = rng.quality, specificity
+		}
+	}
+
+	return quality
+}
@@ -0,0 +1,119 @@
+package httputils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+type testRespondBase struct {
+	ID string `json:"id"`
+}
+
+type testRespondUser struct {
+	testRespondBase
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	Tags     []string  `json:"tags"`
+	Password string    `json:"-"`
+	internal string
+}
+
+func TestRespond(t *testing.T) {
+	users := []testRespondUser{
+		{testRespondBase{"1"}, "Joonas", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), []string{"admin"}, "hunter2", ""},
+		{testRespondBase{"2"}, "Doe, John", time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC), nil, "", ""},
+	}
+
+	serve := func(data any, accept string, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		resp := httptest.NewRecorder()
+		Respond(resp, req, data)
+		return resp
+	}
+
+	resp := serve(users, "", "/")
+	assert.Equal(t, resp.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, resp.Header().Get("Vary"), "Accept")
+	assert.Equal(t, resp.Body.String(), `[{"id":"1","name":"Joonas","created":"2024-01-02T03:04:05Z","tags":["admin"]},{"id":"2","name":"Doe, John","created":"2024-02-03T04:05:06Z","tags":null}]
+`)
+
+	resp = serve(users, "application/x-ndjson", "/")
+	assert.Equal(t, resp.Header().Get("Content-Type"), "application/x-ndjson")
+	assert.Equal(t, resp.Body.String(), `{"id":"1","name":"Joonas","created":"2024-01-02T03:04:05Z","tags":["admin"]}
+{"id":"2","name":"Doe, John","created":"2024-02-03T04:05:06Z","tags":null}
+`)
+
+	resp = serve(users, "text/csv", "/")
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+	assert.Equal(t, resp.Body.String(), `id,name,created,tags
+1,Joonas,2024-01-02T03:04:05Z,"[""admin""]"
+2,"Doe, John",2024-02-03T04:05:06Z,null
+`)
+
+	// pointers to list and items
+	resp = serve(&[]*testRespondUser{&users[0], nil}, "text/csv", "/")
+	assert.Equal(t, resp.Body.String(), `id,name,created,tags
+1,Joonas,2024-01-02T03:04:05Z,"[""admin""]"
+,,,
+`)
+
+	resp = serve(map[string]int{"a": 1}, "", "/?pretty")
+	assert.Equal(t, resp.Body.String(), "{\n  \"a\": 1\n}\n")
+	assert.Equal(t, serve(map[string]int{"a": 1}, "", "/?pretty=false").Body.String(), "{\"a\":1}\n")
+
+	resp = serve("hello", "text/plain", "/")
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, resp.Body.String(), "hello\n")
+
+	assert.Equal(t, serve([]time.Duration{time.Second, time.Minute}, "text/*", "/").Body.String(), "1s\n1m0s\n")
+	assert.Equal(t, serve(42, "text/plain", "/").Body.String(), "42\n")
+
+	// text-like structs are not records
+	timestamps := []time.Time{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	assert.Equal(t, serve(timestamps, "text/csv", "/").Code, http.StatusNotAcceptable)
+	assert.Equal(t, serve(timestamps, "text/csv;q=1, text/plain;q=0.5", "/").Body.String(), "2024-01-02T03:04:05Z\n")
+
+	// not acceptable
+	resp = serve(users, "image/png", "/")
+	assert.Equal(t, resp.Code, http.StatusNotAcceptable)
+	assert.Equal(t, decodeProblem(t, resp).Detail, "supported types: application/json, application/x-ndjson, text/csv")
+
+	// CSV and NDJSON are not available for non-lists, nor text for structs
+	assert.Equal(t, serve(users[0], "text/csv, text/plain", "/").Code, http.StatusNotAcceptable)
+	assert.Equal(t, serve(users[0], "application/x-ndjson", "/").Code, http.StatusNotAcceptable)
+}
+
+func TestNegotiateResponseFormat(t *testing.T) {
+	formats := responseFormatsFor([]string{"a"})
+
+	negotiate := func(accept string) string {
+		format := negotiateResponseFormat(accept, formats)
+		if format == nil {
+			return "<none>"
+		}
+		return format.mediaType
+	}
+
+	assert.Equal(t, negotiate(""), "application/json")
+	assert.Equal(t, negotiate("*/*"), "application/json")
+	assert.Equal(t, negotiate("text/plain"), "text/plain")
+	assert.Equal(t, negotiate("Text/Plain; charset=utf-8"), "text/plain")
+	assert.Equal(t, negotiate("text/plain;q=0.5, application/json"), "application/json")
+	assert.Equal(t, negotiate("text/plain, application/json;q=0.9"), "text/plain")
+	assert.Equal(t, negotiate("application/*"), "application/json") // tie goes to our preference
+	assert.Equal(t, negotiate("application/*;q=0.5, application/x-ndjson"), "application/x-ndjson")
+	// more specific range wins even if it has lower quality
+	assert.Equal(t, negotiate("*/*;q=1, application/json;q=0, application/x-ndjson;q=0.1"), "text/plain")
+	assert.Equal(t, negotiate("application/json;q=0"), "<none>")
+	assert.Equal(t, negotiate("text/csv"), "<none>")
+	assert.Equal(t, negotiate("application/json;q=nonsense, text/plain;q=0.1"), "text/plain")
+	assert.Equal(t, negotiate("garbage"), "application/json")
+}
@@ -0,0 +1,513 @@
+package httputils
+
+// Reverse proxy for fronting internal services. Regular requests are proxied with `httputil.ReverseProxy`,
+// upgrades (WebSocket etc.) and CONNECT tunnels are hijacked and piped with `bidipipe.Pipe()`.
+//
+//	api, _ := httputils.NewUpstreamPool([]string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}, "/healthz")
+//	tasks.Start("healthchecks", api.RunHealthChecks)
+//	proxy := httputils.NewReverseProxy([]httputils.ProxyRoute{{PathPrefix: "/api/", Upstreams: api}}, httputils.ReverseProxyOptions{})
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/function61/gokit/io/bidipipe"
+)
+
+const proxyUpgradeHandshakeTimeout = 30 * time.Second // for upstream to respond to the upgrade request
+
+var (
+	DefaultHealthCheckInterval = 10 * time.Second
+	ErrNoHealthyUpstreams      = errors.New("no healthy upstreams")
+)
+
+type ProxyRoute struct {
+	PathPrefix string // longest matching prefix wins
+	Upstreams  *UpstreamPool
+}
+
+type ReverseProxyOptions struct {
+	// keep X-Forwarded-* and Forwarded from the client (append to them). only enable if we're behind
+	// another proxy that sets them, otherwise clients can spoof their IP.
+	TrustForwardedHeaders bool
+	// send client's `Host` to upstream instead of upstream's own host
+	PreserveHost bool
+	// enables CONNECT tunnelling to "host:port" targets allowed by this. nil = CONNECT not allowed.
+	AllowConnect func(hostPort string) bool
+	// defaults to http.DefaultTransport. for upgrades (WebSocket etc.) only `*http.Transport`'s dialers and
+	// TLS config are used, as the upstream connection is dialed by us. CONNECT tunnels don't use this.
+	Transport http.RoundTripper
+}
+
+type ReverseProxy struct {
+	routes []ProxyRoute
+	opts   ReverseProxyOptions
+}
+
+var _ http.Handler = (*ReverseProxy)(nil)
+
+func NewReverseProxy(routes []ProxyRoute, opts ReverseProxyOptions) *ReverseProxy {
+	routes = append([]ProxyRoute{}, routes...)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].PathPrefix) > len(routes[j].PathPrefix) })
+
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+
+	return &ReverseProxy{routes: routes, opts: opts}
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+
+	route := p.routeFor(r.URL.Path)
+	if route == nil {
+		Error(w, http.StatusNotFound)
+		return
+	}
+
+	upstream, err := route.Upstreams.Next()
+	if err != nil {
+		RequestLogger(r).Warn("proxy", "err", err, "route", route.PathPrefix)
+		Error(w, http.StatusServiceUnavailable)
+		return
+	}
+
+	if isUpgradeRequest(r) {
+		p.serveUpgrade(w, r, upstream)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(upstream)
+			p.rewriteCommon(pr.Out, pr.In)
+		},
+		Transport: p.opts.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			RequestLogger(r).Error("proxy", "err", err, "upstream", upstream.String())
+			Error(w, http.StatusBadGateway)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+func (p *ReverseProxy) routeFor(path string) *ProxyRoute {
+	for i := range p.routes { // sorted longest-first
+		if strings.HasPrefix(path, p.routes[i].PathPrefix) {
+			return &p.routes[i]
+		}
+	}
+
+	return nil
+}
+
+func (p *ReverseProxy) rewriteCommon(out *http.Request, in *http.Request) {
+	if p.opts.PreserveHost {
+		out.Host = in.Host
+	}
+
+	setForwardedHeaders(out.Header, in, p.opts.TrustForwardedHeaders)
+}
+
+// upstream's response to the upgrade is relayed to the client, and if it's 101 both connections are taken over and piped
+func (p *ReverseProxy) serveUpgrade(w http.ResponseWriter, r *http.Request, upstream *url.URL) {
+	logger := RequestLogger(r)
+
+	out := r.Clone(r.Context())
+	out.URL = &url.URL{ // same joining as `httputil.ProxyRequest.SetURL()` does
+		Scheme:   upstream.Scheme,
+		Host:     upstream.Host,
+		Path:     strings.TrimSuffix(upstream.Path, "/") + r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	}
+	out.Host = upstream.Host
+	out.RequestURI = ""
+	removeHopByHopHeaders(out.Header)
+	out.Header.Set("Connection", "Upgrade")
+	out.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+	p.rewriteCommon(out, r)
+
+	upstreamConn, err := dialUpstream(r.Context(), upstream, p.opts.Transport)
+	if err != nil {
+		logger.Error("proxy upgrade", "err", err, "upstream", upstream.String())
+		Error(w, http.StatusBadGateway)
+		return
+	}
+	defer upstreamConn.Close()
+
+	if err := upstreamConn.SetDeadline(time.Now().Add(proxyUpgradeHandshakeTimeout)); err != nil {
+		logger.Error("proxy upgrade", "err", err)
+		Error(w, http.StatusBadGateway)
+		return
+	}
+
+	if err := out.Write(upstreamConn); err != nil {
+		logger.Error("proxy upgrade", "err", err, "upstream", upstream.String())
+		Error(w, http.StatusBadGateway)
+		return
+	}
+
+	upstreamReader := bufio.NewReader(upstreamConn)
+
+	resp, err := http.ReadResponse(upstreamReader, out)
+	if err != nil {
+		logger.Error("proxy upgrade", "err", err, "upstream", upstream.String())
+		Error(w, http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols { // upstream declined => regular response
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	clientConn, clientBuffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		logger.Error("proxy upgrade", "err", err)
+		Error(w, http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	// the hijacked conn keeps the server's deadlines (`WriteTimeout` etc.), which would cut long-lived
+	// connections. upstream conn had the handshake deadline.
+	if err := clientConn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+	if err := upstreamConn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	// hand-written because Response.Write() would add headers not belonging to a 101
+	if _, err := io.WriteString(clientConn, "HTTP/1.1 101 Switching Protocols\r\n"); err != nil {
+		return
+	}
+	if err := resp.Header.Write(clientConn); err != nil {
+		return
+	}
+	if _, err := io.WriteString(clientConn, "\r\n"); err != nil {
+		return
+	}
+
+	if err := bidipipe.Pipe(
+		bidipipe.WithName("client", &bufferedConn{clientConn, clientBuffered.Reader}),
+		bidipipe.WithName("upstream", &bufferedConn{upstreamConn, upstreamReader}),
+	); err != nil {
+		logger.Debug("proxy upgrade ended", "err", err)
+	}
+}
+
+func (p *ReverseProxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if p.opts.AllowConnect == nil || !p.opts.AllowConnect(r.Host) {
+		Error(w, http.StatusForbidden)
+		return
+	}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	targetConn, err := dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		RequestLogger(r).Error("proxy CONNECT", "err", err, "target", r.Host)
+		Error(w, http.StatusBadGateway)
+		return
+	}
+	defer targetConn.Close()
+
+	clientConn, clientBuffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		RequestLogger(r).Error("proxy CONNECT", "err", err)
+		Error(w, http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	// the hijacked conn keeps the server's deadlines (`WriteTimeout` etc.), which would cut the tunnel
+	if err := clientConn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	if _, err := io.WriteString(clientConn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	if err := bidipipe.Pipe(
+		bidipipe.WithName("client", &bufferedConn{clientConn, clientBuffered.Reader}),
+		bidipipe.WithName("target", targetConn),
+	); err != nil {
+		RequestLogger(r).Debug("proxy CONNECT ended", "err", err)
+	}
+}
+
+// round-robin over healthy upstreams. all upstreams are considered healthy until health checks say otherwise.
+type UpstreamPool struct {
+	upstreams           []*poolUpstream
+	next                atomic.Uint64
+	healthCheckPath     string
+	healthCheckInterval time.Duration
+	healthCheckClient   *http.Client
+}
+
+type poolUpstream struct {
+	url       *url.URL
+	unhealthy atomic.Bool
+}
+
+// *healthCheckPath* ("/healthz") is requested from each upstream by RunHealthChecks(). 2xx = healthy.
+func NewUpstreamPool(upstreamURLs []string, healthCheckPath string) (*UpstreamPool, error) {
+	if len(upstreamURLs) == 0 {
+		return nil, errors.New("NewUpstreamPool: no upstreams")
+	}
+
+	pool := &UpstreamPool{
+		healthCheckPath:     healthCheckPath,
+		healthCheckInterval: DefaultHealthCheckInterval,
+		healthCheckClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+
+	for _, upstreamURL := range upstreamURLs {
+		u, err := url.Parse(upstreamURL)
+		if err != nil {
+			return nil, fmt.Errorf("NewUpstreamPool: %w", err)
+		}
+
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("NewUpstreamPool: unsupported scheme: %s", upstreamURL)
+		}
+
+		pool.upstreams = append(pool.upstreams, &poolUpstream{url: u})
+	}
+
+	return pool, nil
+}
+
+func (p *UpstreamPool) Next() (*url.URL, error) {
+	start := p.next.Add(1)
+
+	for i := 0; i < len(p.upstreams); i++ {
+		upstream := p.upstreams[(start+uint64(i))%uint64(len(p.upstreams))]
+		if !upstream.unhealthy.Load() {
+			return upstream.url, nil
+		}
+	}
+
+	return nil, ErrNoHealthyUpstreams
+}
+
+// checks all upstreams concurrently and waits for the results
+func (p *UpstreamPool) CheckHealth(ctx context.Context) {
+	done := make(chan *poolUpstream, len(p.upstreams))
+
+	for _, upstream := range p.upstreams {
+		go func(upstream *poolUpstream) {
+			upstream.unhealthy.Store(!p.healthy(ctx, upstream.url))
+			done <- upstream
+		}(upstream)
+	}
+
+	for range p.upstreams {
+		<-done
+	}
+}
+
+// checks health periodically until *ctx* is canceled (a taskrunner task)
+func (p *UpstreamPool) RunHealthChecks(ctx context.Context) error {
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		p.CheckHealth(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *UpstreamPool) healthy(ctx context.Context, upstream *url.URL) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.JoinPath(p.healthCheckPath).String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := p.healthCheckClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // so the connection can be reused
+
+	return resp.StatusCode >= 200 && resp.StatusCode <= 299
+}
+
+// X-Forwarded-For/Host/Proto and their standardized successor Forwarded (RFC 7239)
+func setForwardedHeaders(out http.Header, in *http.Request, trustIncoming bool) {
+	clientIP, _, err := net.SplitHostPort(in.RemoteAddr)
+	if err != nil {
+		clientIP = in.RemoteAddr
+	}
+
+	proto := "http"
+	if in.TLS != nil {
+		proto = "https"
+	}
+
+	incoming := func(key string) string {
+		if !trustIncoming {
+			return ""
+		}
+		return strings.Join(in.Header.Values(key), ", ")
+	}
+
+	appendTo := func(prior string, value string) string {
+		if prior == "" {
+			return value
+		}
+		return prior + ", " + value
+	}
+
+	out.Set("X-Forwarded-For", appendTo(incoming("X-Forwarded-For"), clientIP))
+
+	// these describe the original request, so the first proxy's values are kept
+	if host := incoming("X-Forwarded-Host"); host != "" {
+		out.Set("X-Forwarded-Host", host)
+	} else {
+		out.Set("X-Forwarded-Host", in.Host)
+	}
+	if incomingProto := incoming("X-Forwarded-Proto"); incomingProto != "" {
+		out.Set("X-Forwarded-Proto", incomingProto)
+	} else {
+		out.Set("X-Forwarded-Proto", proto)
+	}
+
+	forFor := clientIP
+	if strings.Contains(clientIP, ":") { // IPv6 must be bracketed and quoted
+		forFor = `"[` + clientIP + `]"`
+	}
+
+	out.Set("Forwarded", appendTo(incoming("Forwarded"), fmt.Sprintf("for=%s;host=%s;proto=%s", forFor, forwardedQuoteIfNeeded(in.Host), proto)))
+}
+
+func forwardedQuoteIfNeeded(value string) string {
+	if strings.ContainsAny(value, `:[]";, `) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	return value
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && headerHasToken(r.Header, "Connection", "upgrade")
+}
+
+func headerHasToken(h http.Header, key string, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// https://www.rfc-editor.org/rfc/rfc9110#section-7.6.1
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, key := range strings.Split(value, ",") {
+			h.Del(strings.TrimSpace(key))
+		}
+	}
+
+	for _, key := range []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"} {
+		h.Del(key)
+	}
+}
+
+// uses dialers and TLS config of *transport* if it's a `*http.Transport`
+func dialUpstream(ctx context.Context, upstream *url.URL, transport http.RoundTripper) (net.Conn, error) {
+	dial := (&net.Dialer{Timeout: 10 * time.Second}).DialContext
+	var dialTLS func(ctx context.Context, network string, addr string) (net.Conn, error)
+	tlsConfig := &tls.Config{}
+
+	if httpTransport, ok := transport.(*http.Transport); ok {
+		if httpTransport.DialContext != nil {
+			dial = httpTransport.DialContext
+		}
+
+		dialTLS = httpTransport.DialTLSContext
+
+		if httpTransport.TLSClientConfig != nil {
+			tlsConfig = httpTransport.TLSClientConfig.Clone()
+		}
+	}
+
+	host := upstream.Host
+	if upstream.Port() == "" {
+		if upstream.Scheme == "https" {
+			host = net.JoinHostPort(upstream.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(upstream.Hostname(), "80")
+		}
+	}
+
+	if upstream.Scheme != "https" {
+		return dial(ctx, "tcp", host)
+	}
+
+	if dialTLS != nil {
+		return dialTLS(ctx, "tcp", host)
+	}
+
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = upstream.Hostname()
+	}
+	tlsConfig.NextProtos = []string{"http/1.1"} // upgrades are HTTP/1.1 only
+
+	rawConn, err := dial(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(rawConn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// reads first what was already buffered (f.ex. by net/http before hijack)
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
@@ -0,0 +1,206 @@
+package httputils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestReverseProxy(t *testing.T) {
+	backend2Healthy := atomic.Bool{}
+	backend2Healthy.Store(true)
+
+	backend := func(name string, healthy func() bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" {
+				if !healthy() {
+					Error(w, http.StatusServiceUnavailable)
+				}
+				return
+			}
+
+			fmt.Fprintf(w, "%s %s xff=%s xfh=%s xfp=%s fwd=%s",
+				name,
+				r.URL.RequestURI(),
+				r.Header.Get("X-Forwarded-For"),
+				r.Header.Get("X-Forwarded-Host"),
+				r.Header.Get("X-Forwarded-Proto"),
+				r.Header.Get("Forwarded"))
+		}))
+	}
+
+	backend1 := backend("backend1", func() bool { return true })
+	defer backend1.Close()
+	backend2 := backend("backend2", backend2Healthy.Load)
+	defer backend2.Close()
+	backendDown := httptest.NewServer(nil)
+	backendDown.Close()
+
+	apiPool, err := NewUpstreamPool([]string{backend1.URL, backend2.URL}, "/healthz")
+	assert.Ok(t, err)
+	deadPool, err := NewUpstreamPool([]string{backendDown.URL}, "/healthz")
+	assert.Ok(t, err)
+	deadPool.CheckHealth(context.Background())
+
+	proxy := httptest.NewServer(NewReverseProxy([]ProxyRoute{
+		{PathPrefix: "/", Upstreams: deadPool},
+		{PathPrefix: "/api/", Upstreams: apiPool},
+	}, ReverseProxyOptions{}))
+	defer proxy.Close()
+
+	get := func(path string) string {
+		req, err := http.NewRequest(http.MethodGet, proxy.URL+path, nil)
+		assert.Ok(t, err)
+		req.Host = "example.com"
+		req.Header.Set("X-Forwarded-For", "6.6.6.6") // spoofed, not trusted
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.Ok(t, err)
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Sprintf("%d %s", resp.StatusCode, body)
+	}
+
+	// round-robin
+	responses := get("/api/items?id=1") + "\n" + get("/api/items?id=1")
+	assert.Equal(t, strings.Contains(responses, "backend1"), true)
+	assert.Equal(t, strings.Contains(responses, "backend2"), true)
+	assert.Matches(t, responses, `200 backend\d /api/items\?id=1 xff=127\.0\.0\.1 xfh=example\.com xfp=http fwd=for=127\.0\.0\.1;host=example\.com;proto=http`)
+
+	backend2Healthy.Store(false)
+	apiPool.CheckHealth(context.Background())
+	for i := 0; i < 3; i++ {
+		assert.Matches(t, get("/api/"), "^200 backend1 ")
+	}
+
+	assert.Equal(t, get("/other"), "503 Service Unavailable\n")
+}
+
+func TestReverseProxyUpgrade(t *testing.T) {
+	// echo protocol after upgrade. TLS to check that transport's TLS config (trusting the test CA) is used
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || r.Header.Get("X-Forwarded-For") == "" {
+			Error(w, http.StatusBadRequest)
+			return
+		}
+
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_, _ = io.Copy(conn, brw)
+	}))
+	defer backend.Close()
+
+	pool, err := NewUpstreamPool([]string{backend.URL}, "/healthz")
+	assert.Ok(t, err)
+
+	proxy := httptest.NewUnstartedServer(NewReverseProxy([]ProxyRoute{{PathPrefix: "/", Upstreams: pool}}, ReverseProxyOptions{
+		Transport: backend.Client().Transport,
+	}))
+	proxy.Config.WriteTimeout = 50 * time.Millisecond // must not apply to the upgraded connection
+	proxy.Start()
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	assert.Ok(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	assert.Ok(t, err)
+
+	connReader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(connReader, nil)
+	assert.Ok(t, err)
+	assert.Equal(t, resp.StatusCode, http.StatusSwitchingProtocols)
+	assert.Equal(t, resp.Header.Get("Upgrade"), "echo")
+
+	time.Sleep(100 * time.Millisecond) // past the WriteTimeout
+
+	_, err = io.WriteString(conn, "ping\n")
+	assert.Ok(t, err)
+
+	line, err := connReader.ReadString('\n')
+	assert.Ok(t, err)
+	assert.Equal(t, line, "ping\n")
+}
+
+func TestReverseProxyConnect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello from target")
+	}))
+	defer target.Close()
+
+	targetAddr := target.Listener.Addr().String()
+
+	proxy := httptest.NewServer(NewReverseProxy(nil, ReverseProxyOptions{
+		AllowConnect: func(hostPort string) bool { return hostPort == targetAddr },
+	}))
+	defer proxy.Close()
+
+	connect := func(hostPort string) (*http.Response, net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+		assert.Ok(t, err)
+
+		_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", hostPort, hostPort)
+		assert.Ok(t, err)
+
+		connReader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(connReader, &http.Request{Method: http.MethodConnect})
+		assert.Ok(t, err)
+		return resp, conn, connReader
+	}
+
+	resp, conn, _ := connect("127.0.0.1:1")
+	conn.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusForbidden)
+
+	resp, conn, connReader := connect(targetAddr)
+	defer conn.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	// talk HTTP to the target through the tunnel
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: target\r\n\r\n")
+	assert.Ok(t, err)
+
+	targetResp, err := http.ReadResponse(connReader, nil)
+	assert.Ok(t, err)
+	body, _ := io.ReadAll(targetResp.Body)
+	assert.Equal(t, string(body), "hello from target")
+}
+
+func TestSetForwardedHeaders(t *testing.T) {
+	in := httptest.NewRequest(http.MethodGet, "/", nil)
+	in.RemoteAddr = "[2001:db8::1]:1234"
+	in.Host = "example.com:8080"
+	in.Header.Set("X-Forwarded-For", "203.0.113.1")
+	in.Header.Set("X-Forwarded-Proto", "https")
+	in.Header.Set("Forwarded", "for=203.0.113.1;proto=https")
+
+	out := http.Header{}
+	setForwardedHeaders(out, in, true)
+	assert.Equal(t, out.Get("X-Forwarded-For"), "203.0.113.1, 2001:db8::1")
+	assert.Equal(t, out.Get("X-Forwarded-Host"), "example.com:8080")
+	assert.Equal(t, out.Get("X-Forwarded-Proto"), "https")
+	assert.Equal(t, out.Get("Forwarded"), `for=203.0.113.1;proto=https, for="[2001:db8::1]";host="example.com:8080";proto=http`)
+
+	out = http.Header{}
+	setForwardedHeaders(out, in, false)
+	assert.Equal(t, out.Get("X-Forwarded-For"), "2001:db8::1")
+	assert.Equal(t, out.Get("X-Forwarded-Proto"), "http")
+	assert.Equal(t, out.Get("Forwarded"), `for="[2001:db8::1]";host="example.com:8080";proto=http`)
+}
@@ -0,0 +1,148 @@
+package httputils
+
+// Server-Sent Events: https://html.spec.whatwg.org/multipage/server-sent-events.html
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// comments keep proxies and load balancers from closing idle connections
+var DefaultSSEKeepAlive = 15 * time.Second
+
+type ServerSentEvent struct {
+	ID    string        // optional. browser sends it back as `Last-Event-ID` when reconnecting
+	Event string        // optional. event type (for `addEventListener()`), defaults to "message" in the browser
+	Data  string        // can contain newlines
+	Retry time.Duration // optional. tells browser how long to wait before reconnecting
+}
+
+// safe for concurrent use
+type SSEWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	mu         sync.Mutex
+}
+
+// starts the event stream response
+func NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	controller := http.NewResponseController(w)
+
+	// server's WriteTimeout would cut long-lived streams
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, fmt.Errorf("NewSSEWriter: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the response otherwise
+	w.WriteHeader(http.StatusOK)
+
+	sse := &SSEWriter{w: w, controller: controller}
+
+	if err := controller.Flush(); err != nil { // so the client knows right away the stream is open
+		return nil, fmt.Errorf("NewSSEWriter: streaming not supported: %w", err)
+	}
+
+	return sse, nil
+}
+
+func (s *SSEWriter) Send(event ServerSentEvent) error {
+	if strings.ContainsAny(event.ID, "\r\n\x00") || strings.ContainsAny(event.Event, "\r\n") {
+		return errors.New("SSEWriter: event ID and type must not contain newlines")
+	}
+
+	msg := &strings.Builder{}
+	if event.ID != "" {
+		msg.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Event != "" {
+		msg.WriteString("event: " + event.Event + "\n")
+	}
+	if event.Retry > 0 {
+		msg.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	// each line needs its own field. browser joins them back with "\n"
+	for _, line := range strings.Split(normalizeNewlines(event.Data), "\n") {
+		msg.WriteString("data: " + line + "\n")
+	}
+	msg.WriteString("\n") // dispatches the event
+
+	return s.write(msg.String())
+}
+
+// comments are ignored by the browser
+func (s *SSEWriter) Comment(text string) error {
+	msg := &strings.Builder{}
+	for _, line := range strings.Split(normalizeNewlines(text), "\n") {
+		msg.WriteString(": " + line + "\n")
+	}
+
+	return s.write(msg.String())
+}
+
+func (s *SSEWriter) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+
+	return s.controller.Flush()
+}
+
+// streams *events* to the client until *events* is closed, the client disconnects or the server starts
+// shutting down (see ShuttingDown(); clients reconnect by themselves). keep-alive comments are sent
+// every *keepAlive* (0 = DefaultSSEKeepAlive).
+func ServeSSE(w http.ResponseWriter, r *http.Request, events <-chan ServerSentEvent, keepAlive time.Duration) error {
+	if keepAlive == 0 {
+		keepAlive = DefaultSSEKeepAlive
+	}
+
+	sse, err := NewSSEWriter(w)
+	if err != nil {
+		return err
+	}
+
+	keepAliveTicker := time.NewTicker(keepAlive)
+	defer keepAliveTicker.Stop()
+
+	shuttingDown := ShuttingDown(r.Context())
+
+	for {
+		select {
+		case <-shuttingDown:
+			return nil
+		case <-r.Context().Done():
+			if errors.Is(r.Context().Err(), context.Canceled) { // normal way for a stream to end
+				return nil
+			}
+			return r.Context().Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if err := sse.Send(event); err != nil {
+				return err
+			}
+
+			keepAliveTicker.Reset(keepAlive) // no need for keep-alives while there's traffic
+		case <-keepAliveTicker.C:
+			if err := sse.Comment("keep-alive"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
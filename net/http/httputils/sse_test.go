@@ -0,0 +1,109 @@
+package httputils
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestServeSSE(t *testing.T) {
+	events := make(chan ServerSentEvent, 3)
+	events <- ServerSentEvent{Data: "hello"}
+	events <- ServerSentEvent{ID: "42", Event: "stats", Data: "line 1\nline 2\r\n\nline 4", Retry: 3 * time.Second}
+	events <- ServerSentEvent{ID: "bad\nid"}
+	close(events)
+
+	resp := httptest.NewRecorder()
+	err := ServeSSE(resp, httptest.NewRequest(http.MethodGet, "/", nil), events, time.Hour)
+	assert.Equal(t, err.Error(), "SSEWriter: event ID and type must not contain newlines")
+
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/event-stream")
+	assert.Equal(t, resp.Header().Get("Cache-Control"), "no-cache")
+	assert.Equal(t, resp.Header().Get("X-Accel-Buffering"), "no")
+	assert.Equal(t, resp.Flushed, true)
+	assert.Equal(t, resp.Body.String(), `data: hello
+
+id: 42
+event: stats
+retry: 3000
+data: line 1
+data: line 2
+data: 
+data: line 4
+
+`)
+}
+
+func TestServeSSEKeepAliveAndClientDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	resp := &notifyingRecorder{httptest.NewRecorder(), make(chan string, 100)}
+	result := make(chan error, 1)
+	go func() {
+		result <- ServeSSE(resp, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), make(chan ServerSentEvent), time.Millisecond)
+	}()
+
+	for keepAlives := 0; keepAlives < 2; {
+		if <-resp.writes == ": keep-alive\n" {
+			keepAlives++
+		}
+	}
+
+	cancel() // client went away
+
+	assert.Ok(t, <-result)
+}
+
+func TestServeSSEEndsOnServerShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Ok(t, err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = ServeSSE(w, r, make(chan ServerSentEvent), time.Hour)
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- GracefulServer(ctx, srv, func() error { return srv.Serve(listener) }, GracefulOptions{
+			DrainTimeout: time.Minute,
+		})
+	}()
+
+	resp, err := http.Get("http://" + listener.Addr().String())
+	assert.Ok(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.Header.Get("Content-Type"), "text/event-stream")
+
+	cancel()
+
+	// the stream doesn't hold up the drain
+	assert.Ok(t, <-result)
+
+	rest, err := io.ReadAll(resp.Body)
+	assert.Ok(t, err)
+	assert.Equal(t, string(rest), "")
+}
+
+// signals each write, so tests don't have to guess timings
+type notifyingRecorder struct {
+	*httptest.ResponseRecorder
+	writes chan string
+}
+
+func (n *notifyingRecorder) Write(data []byte) (int, error) {
+	written, err := n.ResponseRecorder.Write(data)
+	select {
+	case n.writes <- string(data):
+	default: // nobody listening anymore
+	}
+	return written, err
+}
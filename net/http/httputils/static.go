@@ -0,0 +1,263 @@
+package httputils
+
+// Static file server for assets and SPAs embedded with `embed.FS`.
+//
+// Differences to `http.FileServer()`: content types come from our own MIME DB (not the OS'),
+// ETags are strong content hashes, `.gz` siblings are served to clients that accept gzip (or
+// compressible content is gzipped on the fly), hashed filenames are cached forever and SPAs
+// can have a fallback to index.
+//
+// NOTE: the FS is assumed to be immutable (like `embed.FS` is), because files' ETags and
+// compressed versions are computed only once.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/function61/gokit/mime"
+)
+
+// matches webpack-like hashed filenames: "app.3f2a9c1b.js", "chunk-0123abcd.css"
+var DefaultImmutableFilenames = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[^.]+$`)
+
+var errStaticIsDirectory = errors.New("is a directory")
+
+const (
+	cacheControlImmutable = "public, max-age=31536000, immutable"
+	compressOnTheFlyMin   = 1024 // smaller than this isn't worth the overhead
+)
+
+type StaticOptions struct {
+	// served (with 200) for missing paths that don't look like files (= have no extension), so that
+	// client-side routing works for f.ex. "/users/123". usually "index.html". empty = 404.
+	SPAFallback string
+	// files whose (base) name matches are served with "cache forever" headers. defaults to DefaultImmutableFilenames
+	ImmutableFilenames *regexp.Regexp
+	// for everything else. defaults to "no-cache" (= always revalidate, which is cheap due to ETag)
+	CacheControl string
+	// don't gzip on the fly (.gz siblings are still served)
+	DisableCompression bool
+}
+
+type staticFileServer struct {
+	files   fs.FS
+	opts    StaticOptions
+	entries sync.Map // file name => *staticEntry
+}
+
+// prepared representations of a file
+type staticEntry struct {
+	contentType string
+	content     []byte
+	etag        string
+	gzipped     []byte // nil if not available
+	gzippedETag string
+}
+
+func StaticFileServer(files fs.FS, opts StaticOptions) http.Handler {
+	if opts.ImmutableFilenames == nil {
+		opts.ImmutableFilenames = DefaultImmutableFilenames
+	}
+
+	if opts.CacheControl == "" {
+		opts.CacheControl = "no-cache"
+	}
+
+	return &staticFileServer{files: files, opts: opts}
+}
+
+func (s *staticFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		Error(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+
+	entry, err := s.entry(name)
+	if errors.Is(err, errStaticIsDirectory) && !strings.HasSuffix(r.URL.Path, "/") {
+		redirectToDirectory(w, r)
+		return
+	}
+	if errors.Is(err, fs.ErrNotExist) && s.opts.SPAFallback != "" && path.Ext(name) == "" {
+		name = s.opts.SPAFallback
+		entry, err = s.entry(name)
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			Error(w, http.StatusNotFound)
+		} else {
+			Error(w, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if s.opts.ImmutableFilenames.MatchString(path.Base(name)) {
+		w.Header().Set("Cache-Control", cacheControlImmutable)
+	} else {
+		w.Header().Set("Cache-Control", s.opts.CacheControl)
+	}
+
+	content, etag := entry.content, entry.etag
+	if entry.gzipped != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			content, etag = entry.gzipped, entry.gzippedETag
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+	}
+
+	w.Header().Set("Content-Type", entry.contentType)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// handles `If-None-Match`, `Range`, `If-Range` and HEAD for us
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+func (s *staticFileServer) entry(name string) (*staticEntry, error) {
+	if entry, found := s.entries.Load(name); found {
+		return entry.(*staticEntry), nil
+	}
+
+	entry, err := s.prepare(name)
+	if err != nil {
+		return nil, err // not cached so that the FS stays the source of truth for errors
+	}
+
+	s.entries.Store(name, entry) // racing preparers produce identical entries, so no harm
+	return entry, nil
+}
+
+func (s *staticFileServer) prepare(name string) (*staticEntry, error) {
+	if strings.HasSuffix(name, ".gz") { // siblings are an implementation detail
+		if _, err := fs.Stat(s.files, strings.TrimSuffix(name, ".gz")); err == nil {
+			return nil, fs.ErrNotExist
+		}
+	}
+
+	stat, err := fs.Stat(s.files, name)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() { // served from "dir/" (by its index.html), so that relative links work
+		return nil, errStaticIsDirectory
+	}
+
+	content, err := fs.ReadFile(s.files, name)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name), mime.OctetStream)
+	if spec, found := mime.SpecByType(contentType); (found && spec.CharEncoding != "") || mime.Is(contentType, mime.TypeText) {
+		contentType += "; charset=utf-8"
+	}
+
+	entry := &staticEntry{
+		contentType: contentType,
+		content:     content,
+		etag:        strongETag(content),
+	}
+
+	gzipped, err := fs.ReadFile(s.files, name+".gz")
+	switch {
+	case err == nil:
+		entry.gzipped = gzipped
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	case !s.opts.DisableCompression && len(content) >= compressOnTheFlyMin && mime.Compressible(mime.TypeByExtension(path.Ext(name), mime.NoFallback)):
+		entry.gzipped, err = gzipBytes(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if entry.gzipped != nil {
+		entry.gzippedETag = strongETag(entry.gzipped) // different representation => different strong ETag
+	}
+
+	return entry, nil
+}
+
+func strongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+func gzipBytes(content []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	gz, err := gzip.NewWriterLevel(buf, gzip.BestCompression) // done only once per file
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := gz.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// like http.FileServer, relative so that it works behind `http.StripPrefix()` too: "/docs" => "docs/"
+func redirectToDirectory(w http.ResponseWriter, r *http.Request) {
+	target := path.Base(r.URL.Path) + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// "gzip, deflate, br" => true. "gzip;q=0" => false. explicit "gzip" overrides "*" regardless of order.
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQuality, anyQuality := -1.0, -1.0 // -1 = not mentioned
+
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.TrimSpace(name)
+
+		quality := 1.0
+		if qStr, hasQ := strings.CutPrefix(strings.TrimSpace(params), "q="); hasQ {
+			var err error
+			if quality, err = strconv.ParseFloat(qStr, 64); err != nil {
+				quality = 0 // malformed = not acceptable
+			}
+		}
+
+		switch {
+		case strings.EqualFold(name, "gzip"):
+			gzipQuality = quality
+		case name == "*":
+			anyQuality = quality
+		}
+	}
+
+	if gzipQuality >= 0 {
+		return gzipQuality > 0
+	}
+
+	return anyQuality > 0
+}
@@ -0,0 +1,124 @@
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestStaticFileServer(t *testing.T) {
+	bigCSS := strings.Repeat("body { color: red; }\n", 100)
+
+	handler := StaticFileServer(fstest.MapFS{
+		"index.html":             {Data: []byte("<html>app</html>")},
+		"app.3f2a9c1b.js":        {Data: []byte("console.log('hi');")},
+		"app.3f2a9c1b.js.gz":     {Data: gzipped(t, "console.log('hi');")},
+		"style.css":              {Data: []byte(bigCSS)},
+		"logo.png":               {Data: []byte("\x89PNG")},
+		"docs/index.html":        {Data: []byte("<html>docs</html>")},
+		"data/feed.unknownextxx": {Data: []byte("?")},
+	}, StaticOptions{SPAFallback: "index.html"})
+
+	serve := func(method string, path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve(http.MethodGet, "/")
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, resp.Body.String(), "<html>app</html>")
+	assert.Equal(t, resp.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	assert.Equal(t, resp.Header().Get("Cache-Control"), "no-cache")
+	etag := resp.Header().Get("ETag")
+	assert.Matches(t, etag, `^"[A-Za-z0-9_-]{22}"$`)
+
+	// revalidation
+	resp = serve(http.MethodGet, "/", "If-None-Match", etag)
+	assert.Equal(t, resp.Code, http.StatusNotModified)
+	assert.Equal(t, resp.Body.String(), "")
+
+	// SPA fallback for client-side routes but not for missing assets
+	assert.Equal(t, serve(http.MethodGet, "/users/123").Body.String(), "<html>app</html>")
+	assert.Equal(t, serve(http.MethodGet, "/missing.js").Code, http.StatusNotFound)
+
+	assert.Equal(t, serve(http.MethodGet, "/docs/").Body.String(), "<html>docs</html>")
+	// like http.FileServer, so that relative links in docs/index.html work
+	resp = serve(http.MethodGet, "/docs?lang=fi")
+	assert.Equal(t, resp.Code, http.StatusMovedPermanently)
+	assert.Equal(t, resp.Header().Get("Location"), "docs/?lang=fi")
+	assert.Equal(t, serve(http.MethodGet, "/data/feed.unknownextxx").Header().Get("Content-Type"), "application/octet-stream")
+	assert.Equal(t, serve(http.MethodGet, "/logo.png").Header().Get("Content-Type"), "image/png")
+
+	// precompressed sibling + immutable caching for hashed name
+	resp = serve(http.MethodGet, "/app.3f2a9c1b.js", "Accept-Encoding", "gzip, br")
+	assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+	assert.Equal(t, resp.Header().Get("Vary"), "Accept-Encoding")
+	assert.Equal(t, resp.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+	assert.Equal(t, gunzip(t, resp.Body.Bytes()), "console.log('hi');")
+
+	resp = serve(http.MethodGet, "/app.3f2a9c1b.js", "Accept-Encoding", "gzip;q=0")
+	assert.Equal(t, resp.Header().Get("Content-Encoding"), "")
+	assert.Equal(t, resp.Body.String(), "console.log('hi');")
+
+	assert.Equal(t, serve(http.MethodGet, "/app.3f2a9c1b.js.gz").Code, http.StatusNotFound)
+
+	// on-the-fly compression for compressible types
+	resp = serve(http.MethodGet, "/style.css", "Accept-Encoding", "gzip")
+	assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+	assert.Equal(t, gunzip(t, resp.Body.Bytes()), bigCSS)
+	assert.Equal(t, serve(http.MethodGet, "/index.html", "Accept-Encoding", "gzip").Header().Get("Content-Encoding"), "") // too small to bother
+
+	resp = serve(http.MethodGet, "/style.css", "Range", "bytes=0-3")
+	assert.Equal(t, resp.Code, http.StatusPartialContent)
+	assert.Equal(t, resp.Body.String(), "body")
+	assert.Equal(t, resp.Header().Get("Content-Range"), "bytes 0-3/2100")
+
+	resp = serve(http.MethodHead, "/style.css")
+	assert.Equal(t, resp.Header().Get("Content-Length"), "2100")
+	assert.Equal(t, resp.Body.String(), "")
+
+	assert.Equal(t, serve(http.MethodPost, "/").Code, http.StatusMethodNotAllowed)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	assert.Equal(t, acceptsGzip(""), false)
+	assert.Equal(t, acceptsGzip("deflate, br"), false)
+	assert.Equal(t, acceptsGzip("deflate, GZIP"), true)
+	assert.Equal(t, acceptsGzip("gzip;q=0.5"), true)
+	assert.Equal(t, acceptsGzip("gzip; q=0"), false)
+	assert.Equal(t, acceptsGzip("*"), true)
+	assert.Equal(t, acceptsGzip("*;q=0"), false)
+	assert.Equal(t, acceptsGzip("*, gzip;q=0"), false) // explicit refusal overrides wildcard
+	assert.Equal(t, acceptsGzip("gzip, *;q=0"), true)
+	assert.Equal(t, acceptsGzip("gzip;q=nonsense"), false)
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(content))
+	assert.Ok(t, err)
+	assert.Ok(t, gz.Close())
+	return buf.Bytes()
+}
+
+func gunzip(t *testing.T, content []byte) string {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	assert.Ok(t, err)
+	plain, err := io.ReadAll(gz)
+	assert.Ok(t, err)
+	return string(plain)
+}
@@ -0,0 +1,28 @@
+package httputils
+
+import (
+	"net/http"
+
+	"github.com/function61/gokit/net/http/tracecontext"
+)
+
+// continues the trace from incoming `traceparent` header (or starts a new trace if there isn't
+// a valid one) with a new span for this request. the span is available via `tracecontext.FromContext()`
+// (which also makes ezhttp propagate it to outgoing requests) and its ids are attached to RequestLogger().
+func TraceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := func() tracecontext.SpanContext {
+			if parent, found := tracecontext.Extract(r.Header); found {
+				return parent.NewChild()
+			} else {
+				return tracecontext.New()
+			}
+		}()
+
+		logger := RequestLogger(r).With("trace_id", span.TraceID, "span_id", span.SpanID)
+
+		ctx := WithLogger(tracecontext.WithSpan(r.Context(), span), logger)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,51 @@
+package httputils
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/net/http/tracecontext"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestTraceContextMiddleware(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	var span tracecontext.SpanContext
+
+	handler := TraceContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ = tracecontext.FromContext(r.Context())
+
+		RequestLogger(r).Info("handling")
+	}))
+
+	// logger from outer middleware is kept and extended
+	withBaseLogger := func(r *http.Request) *http.Request {
+		return r.WithContext(WithLogger(r.Context(), slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), withBaseLogger(req))
+
+	assert.Equal(t, span.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, span.SpanID != "00f067aa0ba902b7", true) // our own span
+	assert.Equal(t, span.Sampled(), true)
+	assert.Equal(t, strings.TrimSpace(logs.String()), "level=INFO msg=handling trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id="+span.SpanID)
+
+	// no incoming trace => new trace
+	handler.ServeHTTP(httptest.NewRecorder(), withBaseLogger(httptest.NewRequest(http.MethodGet, "/", nil)))
+	assert.Equal(t, len(span.TraceID), 32)
+	assert.Equal(t, span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736", true)
+}
@@ -24,49 +24,27 @@ func NoCacheHeaders(w http.ResponseWriter) {
 	w.Header().Set("Cache-Control", "no-store, must-revalidate")
 }
 
-// helper for adapting context cancellation to shutdown the HTTP server
+// helper for adapting context cancellation to shutdown the HTTP server. in-flight requests get
+// DefaultDrainTimeout to finish before their connections are closed. see also GracefulServer().
 func CancelableServer(ctx context.Context, srv *http.Server, serve func() error) error {
-	shutdownerCtx, cancel := context.WithCancel(ctx)
-
-	shutdownResult := make(chan error, 1)
-
-	// this is the actual shutdowner
-	go func() {
-		// triggered by parent cancellation
-		// (or below for cleanup if ListenAndServe() failed by itself)
-		<-shutdownerCtx.Done()
-
-		// can't use parent ctx b/c it'd cancel the Shutdown() itself
-		shutdownResult <- srv.Shutdown(context.Background())
-	}()
-
-	err := serve()
-
-	// ask shutdowner to stop. this is useful only for cleanup where listener failed before
-	// it was requested to shut down b/c parent cancellation didn't happen and thus the
-	// shutdowner would still wait.
-	cancel()
-
-	if err == http.ErrServerClosed { // expected for graceful shutdown (not actually error)
-		return <-shutdownResult // should be nil, unless shutdown fails
-	} else {
-		// some other error
-		// (or nil, but http server should always exit with non-nil error)
-		return err
-	}
+	return serveGracefully(ctx, srv, serve, GracefulOptions{})
 }
 
 // creates an http.HandlerFunc wrapper of an inner func that returns an error.
-// if an error is returned, it is responded to as an HTTP error.
+// if an error is returned, it is responded to as an HTTP error (see RespondError()).
+// use HTTPError or the sentinel errors (ErrNotFound etc.) to control the status code and message.
 func WrapWithErrorHandling(inner func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := inner(w, r); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		recorder := NewResponseRecorder(w) // to know if the response was already started
+
+		if err := inner(recorder, r); err != nil {
+			RespondError(recorder, r, err)
 		}
 	}
 }
 
-// helper for setting JSON header and JSON-marshaling a struct into the HTTP response
+// helper for setting JSON header and JSON-marshaling a struct into the HTTP response.
+// see Respond() for also supporting other formats.
 func RespondJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 
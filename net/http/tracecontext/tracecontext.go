@@ -0,0 +1,131 @@
+// W3C Trace Context (`traceparent` / `tracestate` headers) for distributed request correlation
+// without adopting a full tracing SDK. https://www.w3.org/TR/trace-context/
+package tracecontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/function61/gokit/crypto/cryptoutil"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+
+	FlagSampled byte = 0x01
+)
+
+type SpanContext struct {
+	TraceID    string // 32 lowercase hex chars
+	SpanID     string // 16 lowercase hex chars
+	Flags      byte
+	TraceState string // vendor-specific data, propagated as-is
+}
+
+// starts a new trace
+func New() SpanContext {
+	return SpanContext{
+		TraceID: cryptoutil.RandHex(16),
+		SpanID:  cryptoutil.RandHex(8),
+	}
+}
+
+// new span in the same trace
+func (s SpanContext) NewChild() SpanContext {
+	child := s
+	child.SpanID = cryptoutil.RandHex(8)
+	return child
+}
+
+func (s SpanContext) Sampled() bool {
+	return s.Flags&FlagSampled != 0
+}
+
+// value for the `traceparent` header
+func (s SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", s.TraceID, s.SpanID, s.Flags)
+}
+
+var (
+	// version-traceid-parentid-flags. future versions may append fields after a dash
+	traceparentRe = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})(-.*)?$`)
+
+	allZeroRe = regexp.MustCompile(`^0+$`)
+)
+
+// parses `traceparent` (and optional `tracestate`) header values
+func Parse(traceparent string, tracestate string) (SpanContext, error) {
+	match := traceparentRe.FindStringSubmatch(strings.TrimSpace(traceparent))
+	if match == nil {
+		return SpanContext{}, fmt.Errorf("malformed traceparent: %s", traceparent)
+	}
+
+	version, traceID, spanID, flags, trailer := match[1], match[2], match[3], match[4], match[5]
+
+	switch {
+	case version == "ff":
+		return SpanContext{}, errors.New("invalid traceparent version ff")
+	case version == "00" && trailer != "":
+		return SpanContext{}, errors.New("version 00 traceparent must not have trailing data")
+	case allZeroRe.MatchString(traceID):
+		return SpanContext{}, errors.New("all-zero trace-id")
+	case allZeroRe.MatchString(spanID):
+		return SpanContext{}, errors.New("all-zero parent-id")
+	}
+
+	var flagsParsed byte
+	if _, err := fmt.Sscanf(flags, "%02x", &flagsParsed); err != nil {
+		return SpanContext{}, err
+	}
+
+	return SpanContext{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		Flags:      flagsParsed,
+		TraceState: strings.TrimSpace(tracestate),
+	}, nil
+}
+
+// reads span context from request headers. ok=false if not present or invalid
+func Extract(header http.Header) (SpanContext, bool) {
+	traceparent := header.Get(TraceparentHeader)
+	if traceparent == "" {
+		return SpanContext{}, false
+	}
+
+	// multiple tracestate headers are to be combined like any HTTP list header
+	spanContext, err := Parse(traceparent, strings.Join(header.Values(TracestateHeader), ","))
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	return spanContext, true
+}
+
+// writes span context to request headers
+func Inject(header http.Header, spanContext SpanContext) {
+	header.Set(TraceparentHeader, spanContext.Traceparent())
+
+	if spanContext.TraceState != "" {
+		header.Set(TracestateHeader, spanContext.TraceState)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
+
+type contextKey struct{}
+
+func WithSpan(ctx context.Context, spanContext SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, spanContext)
+}
+
+// current span. ok=false if there isn't one
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	spanContext, ok := ctx.Value(contextKey{}).(SpanContext)
+	return spanContext, ok
+}
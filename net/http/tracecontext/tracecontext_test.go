@@ -0,0 +1,68 @@
+package tracecontext
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestParse(t *testing.T) {
+	spanContext, err := Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "congo=t61rcWkgMzE")
+	assert.Ok(t, err)
+	assert.Equal(t, spanContext.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, spanContext.SpanID, "00f067aa0ba902b7")
+	assert.Equal(t, spanContext.Sampled(), true)
+	assert.Equal(t, spanContext.TraceState, "congo=t61rcWkgMzE")
+	assert.Equal(t, spanContext.Traceparent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// future version with extra field is accepted
+	_, err = Parse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-whatever", "")
+	assert.Ok(t, err)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		errMsg string
+	}{
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "malformed traceparent: 00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "invalid traceparent version ff"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "version 00 traceparent must not have trailing data"},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "all-zero trace-id"},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "all-zero parent-id"},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Parse(tc.input, "")
+			assert.Equal(t, err.Error(), tc.errMsg)
+		})
+	}
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	original := New()
+	original.TraceState = "vendor=value"
+
+	header := http.Header{}
+	Inject(header, original)
+
+	extracted, ok := Extract(header)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, extracted, original)
+
+	child := extracted.NewChild()
+	assert.Equal(t, child.TraceID, original.TraceID)
+	assert.Equal(t, child.SpanID != original.SpanID, true)
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.Equal(t, ok, false)
+
+	spanContext := New()
+
+	fromCtx, ok := FromContext(WithSpan(context.Background(), spanContext))
+	assert.Equal(t, ok, true)
+	assert.Equal(t, fromCtx, spanContext)
+}
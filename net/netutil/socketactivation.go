@@ -0,0 +1,194 @@
+package netutil
+
+// systemd socket activation: systemd (or a compatible supervisor) creates the sockets and passes them
+// to us as inherited fds, so the sockets stay open (and connections queue up) across restarts.
+//
+// https://www.freedesktop.org/software/systemd/man/latest/sd_listen_fds.html
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	systemdListenFdsStart  = 3 // SD_LISTEN_FDS_START. fds 0-2 are stdin/stdout/stderr
+	systemdUnknownSockName = "unknown"
+)
+
+// sockets passed to us by systemd, by their `FileDescriptorName=` (defaults to the .socket unit's name).
+// sockets are handed out only once, so that two users don't end up serving the same socket.
+type SystemdSockets struct {
+	listeners   map[string][]net.Listener
+	packetConns map[string][]net.PacketConn
+	mu          sync.Mutex
+}
+
+// process-wide because the fds can only be taken over once
+var (
+	systemdSockets     *SystemdSockets
+	systemdSocketsErr  error
+	systemdSocketsOnce sync.Once
+)
+
+// returns nil (without error) if we were not socket activated. the `LISTEN_*` variables are
+// removed from the environment so that child processes don't think they were activated.
+func SystemdActivatedSockets() (*SystemdSockets, error) {
+	systemdSocketsOnce.Do(func() {
+		systemdSockets, systemdSocketsErr = systemdSocketsFromEnv()
+	})
+
+	return systemdSockets, systemdSocketsErr
+}
+
+// takes the next socket-activated stream socket (TCP, Unix) named *name*. nil if there is none left.
+func (s *SystemdSockets) Listener(name string) net.Listener {
+	if s == nil { // not activated
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listeners := s.listeners[name]
+	if len(listeners) == 0 {
+		return nil
+	}
+
+	s.listeners[name] = listeners[1:]
+	return listeners[0]
+}
+
+// takes the next socket-activated datagram socket (UDP, unixgram) named *name*. nil if there is none left.
+func (s *SystemdSockets) PacketConn(name string) net.PacketConn {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conns := s.packetConns[name]
+	if len(conns) == 0 {
+		return nil
+	}
+
+	s.packetConns[name] = conns[1:]
+	return conns[0]
+}
+
+// uses socket-activated listener *name* if there is one, otherwise listens on *sockPath* like ListenUnixWithMode()
+func ListenSystemdOrUnix(name string, sockPath string, mode *os.FileMode, with func(net.Listener) error) error {
+	listener, err := systemdListener(name)
+	if err != nil {
+		return err
+	}
+
+	if listener == nil {
+		return ListenUnixWithMode(sockPath, mode, with)
+	}
+
+	return with(listener) // not removing the socket file as it's owned by systemd
+}
+
+// uses socket-activated listener *name* if there is one, otherwise listens on TCP *addr* (like ":80")
+func ListenSystemdOrTCP(name string, addr string, with func(net.Listener) error) error {
+	listener, err := systemdListener(name)
+	if err != nil {
+		return err
+	}
+
+	if listener == nil {
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("ListenSystemdOrTCP: %w", err)
+		}
+	}
+
+	return with(listener)
+}
+
+func systemdListener(name string) (net.Listener, error) {
+	sockets, err := SystemdActivatedSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	return sockets.Listener(name), nil
+}
+
+func systemdSocketsFromEnv() (*SystemdSockets, error) {
+	withErr := func(err error) (*SystemdSockets, error) { return nil, fmt.Errorf("systemd socket activation: %w", err) }
+
+	names, err := parseSystemdListenEnv(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), os.Getpid())
+
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(key)
+	}
+
+	if err != nil || names == nil {
+		return nil, err
+	}
+
+	sockets := &SystemdSockets{
+		listeners:   map[string][]net.Listener{},
+		packetConns: map[string][]net.PacketConn{},
+	}
+
+	for i, name := range names {
+		fd := systemdListenFdsStart + i
+
+		// File*() dup the fd (with close-on-exec), so the original is not needed after
+		file := os.NewFile(uintptr(fd), name)
+
+		if listener, err := net.FileListener(file); err == nil {
+			sockets.listeners[name] = append(sockets.listeners[name], listener)
+		} else if conn, err := net.FilePacketConn(file); err == nil {
+			sockets.packetConns[name] = append(sockets.packetConns[name], conn)
+		} else {
+			file.Close()
+			return withErr(fmt.Errorf("fd %d (%s) is neither stream nor datagram socket: %w", fd, name, err))
+		}
+
+		file.Close()
+	}
+
+	return sockets, nil
+}
+
+// returns socket names (one for each fd), or nil if the variables are not meant for *pid*
+func parseSystemdListenEnv(listenPID string, listenFDs string, listenFDNames string, pid int) ([]string, error) {
+	if listenPID == "" || listenFDs == "" {
+		return nil, nil
+	}
+
+	if listenPID != strconv.Itoa(pid) { // inherited from parent that was activated, not us
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(listenFDs)
+	if err != nil || count < 0 {
+		return nil, errors.New("systemd socket activation: malformed LISTEN_FDS: " + listenFDs)
+	}
+
+	names := make([]string, count)
+
+	givenNames := []string{}
+	if listenFDNames != "" {
+		givenNames = strings.Split(listenFDNames, ":")
+	}
+
+	for i := range names {
+		if i < len(givenNames) && givenNames[i] != "" {
+			names[i] = givenNames[i]
+		} else {
+			names[i] = systemdUnknownSockName
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,128 @@
+package netutil
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+const socketActivationChildEnv = "NETUTIL_TEST_SOCKET_ACTIVATION_CHILD"
+
+func TestParseSystemdListenEnv(t *testing.T) {
+	parse := func(listenPID string, listenFDs string, listenFDNames string) string {
+		names, err := parseSystemdListenEnv(listenPID, listenFDs, listenFDNames, 123)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("%v", names)
+	}
+
+	assert.Equal(t, parse("", "", ""), "[]")
+	assert.Equal(t, parse("456", "2", "http:dns"), "[]") // meant for someone else
+	assert.Equal(t, parse("123", "2", "http:dns"), "[http dns]")
+	assert.Equal(t, parse("123", "3", "http"), "[http unknown unknown]")
+	assert.Equal(t, parse("123", "1", ""), "[unknown]")
+	assert.Equal(t, parse("123", "x", ""), "systemd socket activation: malformed LISTEN_FDS: x")
+}
+
+// we play systemd: create the sockets and pass them to a child process (this test binary)
+func TestSystemdSocketActivation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fd passing not supported")
+	}
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Ok(t, err)
+	defer tcpListener.Close()
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Ok(t, err)
+	defer udpConn.Close()
+
+	tcpFile, err := tcpListener.(*net.TCPListener).File()
+	assert.Ok(t, err)
+	defer tcpFile.Close()
+
+	udpFile, err := udpConn.(*net.UDPConn).File()
+	assert.Ok(t, err)
+	defer udpFile.Close()
+
+	child := exec.Command(os.Args[0], "-test.run=^TestSystemdSocketActivationChild$", "-test.v")
+	child.ExtraFiles = []*os.File{tcpFile, udpFile} // => fds 3 and 4
+	// LISTEN_PID is set by the child itself as we can't know its pid beforehand
+	child.Env = append(os.Environ(), socketActivationChildEnv+"=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=http:dns")
+	childOutput := &strings.Builder{}
+	child.Stdout = childOutput
+	child.Stderr = childOutput
+	assert.Ok(t, child.Start())
+
+	conn, err := net.Dial("tcp", tcpListener.Addr().String())
+	assert.Ok(t, err)
+	defer conn.Close()
+
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Ok(t, err)
+	assert.Equal(t, greeting, "hello from pid "+strconv.Itoa(child.Process.Pid)+"\n")
+
+	udpClient, err := net.Dial("udp", udpConn.LocalAddr().String())
+	assert.Ok(t, err)
+	defer udpClient.Close()
+
+	_, err = udpClient.Write([]byte("ping"))
+	assert.Ok(t, err)
+
+	reply := make([]byte, 64)
+	n, err := udpClient.Read(reply)
+	assert.Ok(t, err)
+	assert.Equal(t, string(reply[:n]), "pong")
+
+	if err := child.Wait(); err != nil {
+		t.Fatalf("child: %v\n%s", err, childOutput.String())
+	}
+}
+
+// runs in the child process started by TestSystemdSocketActivation
+func TestSystemdSocketActivationChild(t *testing.T) {
+	if os.Getenv(socketActivationChildEnv) != "1" {
+		t.Skip("only run as child of TestSystemdSocketActivation")
+	}
+
+	assert.Ok(t, os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid())))
+
+	sockets, err := SystemdActivatedSockets()
+	assert.Ok(t, err)
+	assert.Equal(t, os.Getenv("LISTEN_FDS"), "") // not leaked to our children
+
+	dns := sockets.PacketConn("dns")
+	assert.Equal(t, dns != nil, true)
+	assert.Equal(t, sockets.PacketConn("dns") == nil, true) // handed out only once
+
+	assert.Ok(t, ListenSystemdOrTCP("http", "127.0.0.1:0", func(listener net.Listener) error {
+		defer listener.Close()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		_, err = fmt.Fprintf(conn, "hello from pid %d\n", os.Getpid())
+		return err
+	}))
+
+	buf := make([]byte, 64)
+	n, from, err := dns.ReadFrom(buf)
+	assert.Ok(t, err)
+	assert.Equal(t, string(buf[:n]), "ping")
+
+	_, err = dns.WriteTo([]byte("pong"), from)
+	assert.Ok(t, err)
+}
@@ -30,7 +30,7 @@ type serviceType string
 
 const (
 	ServiceTypeExec   serviceType = "exec"   // will consider the unit started immediately after the main service binary has been executed
-	ServiceTypeNotify serviceType = "notify" // it is expected that the service sends a "READY=1" notification message
+	ServiceTypeNotify serviceType = "notify" // it is expected that the service sends a "READY=1" notification message (see `systemdnotify.Ready()`)
 )
 
 type Option func(*ServiceDefinition)
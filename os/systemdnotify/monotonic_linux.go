@@ -0,0 +1,15 @@
+package systemdnotify
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// CLOCK_MONOTONIC in microseconds (Go's monotonic clock readings are not exposed)
+func monotonicUsec() (uint64, bool) {
+	ts := unix.Timespec{}
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, false
+	}
+
+	return uint64(ts.Sec)*1e6 + uint64(ts.Nsec)/1e3, true
+}
@@ -0,0 +1,111 @@
+// Implements systemd's service notification protocol (what `sd_notify()` does), so that
+// `Type=notify` services can tell systemd when they're ready, reloading, stopping and alive.
+//
+// https://www.freedesktop.org/software/systemd/man/latest/sd_notify.html
+package systemdnotify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const notifySocketEnv = "NOTIFY_SOCKET"
+
+// sends *states* (like "READY=1") to systemd. no-op if we're not run by systemd
+// (or by a unit that doesn't expect notifications), so it's safe to call unconditionally.
+func Notify(states ...string) error {
+	socketPath := os.Getenv(notifySocketEnv)
+	if socketPath == "" {
+		return nil
+	}
+
+	withErr := func(err error) error { return fmt.Errorf("systemdnotify: %w", err) }
+
+	// "@" prefix means abstract socket, which Go's net package understands natively
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return withErr(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return withErr(err)
+	}
+
+	return nil
+}
+
+// service startup is finished
+func Ready() error {
+	return Notify("READY=1")
+}
+
+// service is reloading its configuration. call Ready() when done.
+func Reloading() error {
+	if usec, ok := monotonicUsec(); ok { // required by `Type=notify-reload`
+		return Notify("RELOADING=1", "MONOTONIC_USEC="+strconv.FormatUint(usec, 10))
+	}
+
+	return Notify("RELOADING=1")
+}
+
+// service is beginning its shutdown
+func Stopping() error {
+	return Notify("STOPPING=1")
+}
+
+// free-form status shown in `$ systemctl status`, like "Serving 12 clients"
+func Status(status string) error {
+	return Notify("STATUS=" + status)
+}
+
+// keep-alive ping for `WatchdogSec=`. see WatchdogPinger() for doing this periodically
+func Watchdog() error {
+	return Notify("WATCHDOG=1")
+}
+
+// returns the interval in which systemd expects watchdog pings. false if watchdog is not enabled for us.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) { // meant for someone else
+		return 0, false
+	}
+
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// pings the watchdog (at half the interval systemd expects, like the docs recommend) until *ctx* is canceled.
+// if watchdog is not enabled just waits for cancellation, so it can be used as a taskrunner task unconditionally:
+//
+//	tasks.Start("watchdog", systemdnotify.WatchdogPinger)
+func WatchdogPinger(ctx context.Context) error {
+	interval, enabled := WatchdogInterval()
+	if !enabled {
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		if err := Watchdog(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
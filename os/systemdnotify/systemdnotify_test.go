@@ -0,0 +1,109 @@
+package systemdnotify
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestNotify(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	messages := listenNotifySocket(t, socketPath)
+
+	t.Setenv(notifySocketEnv, socketPath)
+
+	assert.Ok(t, Ready())
+	assert.Equal(t, <-messages, "READY=1")
+
+	assert.Ok(t, Status("Serving 12 clients"))
+	assert.Equal(t, <-messages, "STATUS=Serving 12 clients")
+
+	assert.Ok(t, Reloading())
+	if runtime.GOOS == "linux" { // monotonic clock reading is Linux-only (like systemd)
+		assert.Matches(t, <-messages, `^RELOADING=1\nMONOTONIC_USEC=\d+$`)
+	} else {
+		assert.Equal(t, <-messages, "RELOADING=1")
+	}
+
+	assert.Ok(t, Stopping())
+	assert.Equal(t, <-messages, "STOPPING=1")
+}
+
+func TestNotifyAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are Linux-only")
+	}
+
+	socketPath := "@gokit-systemdnotify-test-" + strconv.Itoa(os.Getpid())
+	messages := listenNotifySocket(t, socketPath)
+
+	t.Setenv(notifySocketEnv, socketPath)
+
+	assert.Ok(t, Ready())
+	assert.Equal(t, <-messages, "READY=1")
+}
+
+func TestNotifyNotUnderSystemd(t *testing.T) {
+	t.Setenv(notifySocketEnv, "")
+
+	assert.Ok(t, Ready())
+}
+
+func TestWatchdogPinger(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	messages := listenNotifySocket(t, socketPath)
+
+	t.Setenv(notifySocketEnv, socketPath)
+	t.Setenv("WATCHDOG_USEC", "20000") // 20 ms
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	interval, enabled := WatchdogInterval()
+	assert.Equal(t, enabled, true)
+	assert.Equal(t, interval, 20*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- WatchdogPinger(ctx) }()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, <-messages, "WATCHDOG=1")
+	}
+
+	cancel()
+	assert.Ok(t, <-result)
+
+	// watchdog meant for another process
+	t.Setenv("WATCHDOG_PID", "1")
+	_, enabled = WatchdogInterval()
+	assert.Equal(t, enabled, false)
+}
+
+// plays systemd
+func listenNotifySocket(t *testing.T, socketPath string) <-chan string {
+	t.Helper()
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	assert.Ok(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	messages := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+
+	return messages
+}